@@ -58,6 +58,16 @@ func ComparePassword(password, hash string) (bool, error) {
 	return subtle.ConstantTimeCompare(hashBytes, comparisonHash) == 1, nil
 }
 
+// GenerateToken returns a random URL-safe token of n bytes of entropy, e.g.
+// for links that must work without a session
+func GenerateToken(n uint32) (string, error) {
+	b, err := generateRandomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func generateRandomBytes(n uint32) ([]byte, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
@@ -161,6 +171,7 @@ func ValidateSession(r *http.Request) (*Session, error) {
 
 	if time.Now().After(session.Expiry) {
 		delete(sessions, cookie.Value)
+		deleteEncryptionKey(cookie.Value)
 		return nil, fmt.Errorf("session expired")
 	}
 
@@ -172,6 +183,7 @@ func ClearSession(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(SessionCookieName)
 	if err == nil {
 		delete(sessions, cookie.Value)
+		deleteEncryptionKey(cookie.Value)
 	}
 
 	http.SetCookie(w, &http.Cookie{
@@ -189,6 +201,7 @@ func CleanupExpiredSessions() {
 	for sessionID, session := range sessions {
 		if time.Now().After(session.Expiry) {
 			delete(sessions, sessionID)
+			deleteEncryptionKey(sessionID)
 		}
 	}
 }
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Unlocked encryption keys, by session ID. Keys only live in memory and are
+// dropped together with the session. Requests run concurrently, so every
+// access goes through encryptionKeysMu.
+var (
+	encryptionKeys   = map[string][]byte{}
+	encryptionKeysMu sync.RWMutex
+)
+
+// NewKeySalt returns a random salt for DeriveKey
+func NewKeySalt() ([]byte, error) {
+	return generateRandomBytes(p.saltLength)
+}
+
+// DeriveKey derives a 32-byte AES key from a passphrase using Argon2id with
+// the same parameters as password hashing
+func DeriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+}
+
+// Encrypt seals plaintext with AES-GCM and returns base64(nonce || ciphertext)
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateRandomBytes(uint32(gcm.NonceSize()))
+	if err != nil {
+		return "", fmt.Errorf("unable to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt. It fails when the key is wrong
+// or the data was modified.
+func Decrypt(key []byte, encoded string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid ciphertext: too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetEncryptionKey keeps an unlocked key for the request's session
+func SetEncryptionKey(r *http.Request, key []byte) error {
+	if _, err := ValidateSession(r); err != nil {
+		return err
+	}
+	cookie, _ := r.Cookie(SessionCookieName)
+	encryptionKeysMu.Lock()
+	encryptionKeys[cookie.Value] = key
+	encryptionKeysMu.Unlock()
+	return nil
+}
+
+// EncryptionKey returns the key unlocked in the request's session
+func EncryptionKey(r *http.Request) ([]byte, bool) {
+	if _, err := ValidateSession(r); err != nil {
+		return nil, false
+	}
+	cookie, _ := r.Cookie(SessionCookieName)
+	encryptionKeysMu.RLock()
+	key, ok := encryptionKeys[cookie.Value]
+	encryptionKeysMu.RUnlock()
+	return key, ok
+}
+
+// ClearEncryptionKey forgets the key of the request's session
+func ClearEncryptionKey(r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		deleteEncryptionKey(cookie.Value)
+	}
+}
+
+func deleteEncryptionKey(sessionID string) {
+	encryptionKeysMu.Lock()
+	delete(encryptionKeys, sessionID)
+	encryptionKeysMu.Unlock()
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 
 	"goblog/config"
+	"goblog/models"
 
 	_ "github.com/go-sql-driver/mysql" // Import MySQL driver
 )
@@ -87,6 +88,8 @@ func InitDB() error {
 	}
 	migrateDatabase()
 	seedBadges()
+	seedHabitTemplates()
+	CreateMissingTodoColumns()
 	seedCategories()
 	seedSampleData()
 
@@ -103,6 +106,10 @@ func createTables() error {
 		username VARCHAR(255) UNIQUE NOT NULL,
 		email VARCHAR(255) UNIQUE NOT NULL,
 		password VARCHAR(255) NOT NULL,
+		calendar_token VARCHAR(64) NULL UNIQUE,
+		diary_digest TINYINT DEFAULT 0,
+		diary_key_salt VARCHAR(64) NULL,
+		diary_key_check VARCHAR(255) NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`)
 	if err != nil {
@@ -152,6 +159,36 @@ func createTables() error {
 			frequency VARCHAR(50),
 			streak INT DEFAULT 0,
 			total_days INT DEFAULT 0,
+			archived_at DATETIME NULL,
+			routine_id INT NULL,
+			sort_order INT DEFAULT 0,
+			target_value INT DEFAULT 0,
+			target_unit VARCHAR(20) DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS habit_templates (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			code VARCHAR(64) UNIQUE NULL,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			category VARCHAR(50) DEFAULT 'other',
+			icon VARCHAR(50),
+			frequency VARCHAR(50) DEFAULT 'daily',
+			target_value INT DEFAULT 0,
+			target_unit VARCHAR(20) DEFAULT '',
+			routine_kind VARCHAR(20) DEFAULT '',
+			sort_order INT DEFAULT 0,
+			is_active INT DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS habit_routines (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			kind VARCHAR(20) DEFAULT 'custom',
+			reminder_time VARCHAR(5) DEFAULT '',
+			sort_order INT DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(user_id) REFERENCES users(id)
 		);`,
@@ -159,6 +196,20 @@ func createTables() error {
 			id INT PRIMARY KEY AUTO_INCREMENT,
 			habit_id INT,
 			date DATETIME,
+			note VARCHAR(500) DEFAULT '',
+			mood VARCHAR(16) DEFAULT '',
+			duration_minutes INT DEFAULT 0,
+			FOREIGN KEY(habit_id) REFERENCES habits(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS habit_pauses (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			habit_id INT NOT NULL,
+			kind VARCHAR(20) DEFAULT 'pause',
+			start_date DATE NOT NULL,
+			end_date DATE NOT NULL,
+			reason VARCHAR(255) DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_habit_pauses_habit (habit_id, start_date, end_date),
 			FOREIGN KEY(habit_id) REFERENCES habits(id)
 		);`,
 		`CREATE TABLE IF NOT EXISTS todos (
@@ -167,9 +218,54 @@ func createTables() error {
 			content TEXT,
 			status VARCHAR(50) DEFAULT 'pending',
 			due_date DATETIME,
+			priority INT DEFAULT 0,
+			project_id INT NULL,
+			parent_id INT NULL,
+			recurrence_rule VARCHAR(50) DEFAULT '',
+			series_id INT NULL,
+			tags VARCHAR(255) DEFAULT '',
+			column_id INT NULL,
+			board_order INT DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME NULL,
+			ical_uid VARCHAR(255) DEFAULT '',
+			INDEX idx_todos_parent (parent_id),
+			INDEX idx_todos_series (series_id),
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS todo_projects (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			color VARCHAR(20) DEFAULT '#3B82F6',
+			sort_order INT DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS todo_columns (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			name VARCHAR(50) NOT NULL,
+			color VARCHAR(20) DEFAULT '#64748B',
+			wip_limit INT DEFAULT 0,
+			is_done INT DEFAULT 0,
+			sort_order INT DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(user_id) REFERENCES users(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS todo_sessions (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			todo_id INT NOT NULL,
+			user_id INT NOT NULL,
+			kind VARCHAR(20) DEFAULT 'timer',
+			planned_minutes INT DEFAULT 0,
+			started_at DATETIME NOT NULL,
+			ended_at DATETIME NULL,
+			duration_seconds INT DEFAULT 0,
+			INDEX idx_todo_sessions_user (user_id, started_at),
+			FOREIGN KEY(todo_id) REFERENCES todos(id),
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
 		`CREATE TABLE IF NOT EXISTS todo_checkins (
 			id INT PRIMARY KEY AUTO_INCREMENT,
 			todo_id INT,
@@ -177,16 +273,42 @@ func createTables() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(todo_id) REFERENCES todos(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS badge_definitions (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			code VARCHAR(64) UNIQUE NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			icon VARCHAR(50),
+			rule_type VARCHAR(50) NOT NULL,
+			threshold INT NOT NULL DEFAULT 0,
+			sort_order INT DEFAULT 0,
+			is_active INT DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
 		`CREATE TABLE IF NOT EXISTS badges (
 			id INT PRIMARY KEY AUTO_INCREMENT,
 			user_id INT NOT NULL,
+			code VARCHAR(64),
 			name VARCHAR(255),
 			description TEXT,
 			icon VARCHAR(50),
 			unlocked INT DEFAULT 0,
 			condition_days INT,
+			unlocked_at DATETIME NULL,
 			FOREIGN KEY(user_id) REFERENCES users(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS badge_unlocks (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			badge_id INT NOT NULL,
+			reason VARCHAR(255),
+			metric_value DECIMAL(12,2),
+			notified INT DEFAULT 0,
+			unlocked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_badge_unlocks_user (user_id, notified),
+			FOREIGN KEY(user_id) REFERENCES users(id),
+			FOREIGN KEY(badge_id) REFERENCES badges(id)
+		);`,
 		`CREATE TABLE IF NOT EXISTS diaries (
 			id INT PRIMARY KEY AUTO_INCREMENT,
 			user_id INT NOT NULL,
@@ -195,10 +317,53 @@ func createTables() error {
 			weather VARCHAR(50),
 			mood VARCHAR(50),
 			date DATETIME,
+			encrypted TINYINT DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 			FOREIGN KEY(user_id) REFERENCES users(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS diary_drafts (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			diary_id INT NOT NULL DEFAULT 0,
+			title VARCHAR(255) DEFAULT '',
+			content TEXT,
+			weather VARCHAR(50) DEFAULT '',
+			mood VARCHAR(50) DEFAULT '',
+			date VARCHAR(10) DEFAULT '',
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			UNIQUE KEY uniq_diary_drafts (user_id, diary_id),
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS diary_revisions (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			diary_id INT NOT NULL,
+			user_id INT NOT NULL,
+			title VARCHAR(255),
+			content TEXT,
+			weather VARCHAR(50),
+			mood VARCHAR(50),
+			date DATETIME,
+			encrypted TINYINT DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_diary_revisions_diary (diary_id, id),
+			FOREIGN KEY(diary_id) REFERENCES diaries(id),
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id INT PRIMARY KEY AUTO_INCREMENT,
+			user_id INT NOT NULL,
+			kind VARCHAR(30) NOT NULL,
+			title VARCHAR(255) NOT NULL,
+			body VARCHAR(500) DEFAULT '',
+			link VARCHAR(255) DEFAULT '',
+			dedupe_key VARCHAR(100) NOT NULL,
+			is_read INT DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uniq_notification (user_id, dedupe_key),
+			INDEX idx_notifications_unread (user_id, is_read),
+			FOREIGN KEY(user_id) REFERENCES users(id)
+		);`,
 	}
 
 	for _, query := range queries {
@@ -219,39 +384,145 @@ func createTables() error {
 	return nil
 }
 
-// CreateUserBadges creates badges for a specific user
+// defaultBadgeDefinitions is the bundled badge registry, seeded into badge_definitions.
+// Admins can add or deactivate rows in that table; seeding never overwrites them.
+var defaultBadgeDefinitions = []models.BadgeDefinition{
+	{Code: "first_checkin", Name: "初出茅庐", Description: "完成第一次打卡", Icon: "🌱", RuleType: models.BadgeRuleHabitCheckins, Threshold: 1},
+	{Code: "checkins_7", Name: "坚持不懈", Description: "累计打卡7天", Icon: "🔥", RuleType: models.BadgeRuleHabitCheckins, Threshold: 7},
+	{Code: "checkins_21", Name: "习惯养成", Description: "累计打卡21天", Icon: "⭐", RuleType: models.BadgeRuleHabitCheckins, Threshold: 21},
+	{Code: "checkins_100", Name: "自律大师", Description: "累计打卡100天", Icon: "👑", RuleType: models.BadgeRuleHabitCheckins, Threshold: 100},
+	{Code: "habit_streak_7", Name: "一周不断", Description: "单个习惯连续打卡7天", Icon: "📅", RuleType: models.BadgeRuleHabitStreak, Threshold: 7},
+	{Code: "habit_streak_30", Name: "月度坚守", Description: "单个习惯连续打卡30天", Icon: "🏅", RuleType: models.BadgeRuleHabitStreak, Threshold: 30},
+	{Code: "diary_streak_7", Name: "日记新星", Description: "连续7天写日记", Icon: "📖", RuleType: models.BadgeRuleDiaryStreak, Threshold: 7},
+	{Code: "diary_streak_30", Name: "笔耕不辍", Description: "连续30天写日记", Icon: "✍️", RuleType: models.BadgeRuleDiaryStreak, Threshold: 30},
+	{Code: "todos_10", Name: "行动派", Description: "完成10个待办", Icon: "✅", RuleType: models.BadgeRuleTodoCompletion, Threshold: 10},
+	{Code: "todos_100", Name: "任务终结者", Description: "完成100个待办", Icon: "🚀", RuleType: models.BadgeRuleTodoCompletion, Threshold: 100},
+	{Code: "savings_1000", Name: "小有积蓄", Description: "累计结余达到1000元", Icon: "💰", RuleType: models.BadgeRuleSavings, Threshold: 1000},
+	{Code: "savings_10000", Name: "理财能手", Description: "累计结余达到10000元", Icon: "💎", RuleType: models.BadgeRuleSavings, Threshold: 10000},
+}
+
+// CreateUserBadges creates badges for a specific user.
+// It is safe to call repeatedly: badges added to the registry later are
+// appended, and legacy badges created before the registry are linked by name.
 func CreateUserBadges(userID int) {
-	// Check if badges already exist for this user
+	// Link legacy badges (no code) to their definitions
+	_, err := DB.Exec(`
+		UPDATE badges b
+		INNER JOIN badge_definitions d ON b.name = d.name
+		SET b.code = d.code, b.condition_days = d.threshold
+		WHERE b.user_id = ? AND (b.code IS NULL OR b.code = '')
+	`, userID)
+	if err != nil {
+		log.Println("Error linking legacy user badges:", err)
+	}
+
+	_, err = DB.Exec(`
+		INSERT INTO badges (user_id, code, name, description, icon, condition_days)
+		SELECT ?, d.code, d.name, d.description, d.icon, d.threshold
+		FROM badge_definitions d
+		WHERE d.is_active = 1
+		AND NOT EXISTS (SELECT 1 FROM badges b WHERE b.user_id = ? AND b.code = d.code)
+		ORDER BY d.sort_order, d.id
+	`, userID, userID)
+	if err != nil {
+		log.Println("Error creating user badges:", err)
+	}
+}
+
+func seedBadges() {
+	// Badge rows are created per user from badge_definitions (see CreateUserBadges);
+	// here we only make sure the bundled definitions exist.
+	for i, d := range defaultBadgeDefinitions {
+		_, err := DB.Exec(
+			"INSERT IGNORE INTO badge_definitions (code, name, description, icon, rule_type, threshold, sort_order) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			d.Code, d.Name, d.Description, d.Icon, d.RuleType, d.Threshold, i+1,
+		)
+		if err != nil {
+			log.Println("Error seeding badge definitions:", err)
+		}
+	}
+}
+
+// defaultHabitTemplates is the bundled habit template catalog, seeded into habit_templates.
+// Admins can add or deactivate templates; seeding never overwrites them.
+var defaultHabitTemplates = []models.HabitTemplate{
+	{Code: "morning_run", Name: "晨跑", Description: "起床后慢跑，唤醒身体", Category: "exercise", Icon: "🏃", Frequency: "daily", TargetValue: 30, TargetUnit: "分钟", RoutineKind: "morning"},
+	{Code: "workout", Name: "力量训练", Description: "每周进行力量训练，增强体质", Category: "exercise", Icon: "🏋️", Frequency: "weekly", TargetValue: 3, TargetUnit: "次"},
+	{Code: "stretching", Name: "睡前拉伸", Description: "放松肌肉，帮助入睡", Category: "exercise", Icon: "🧘", Frequency: "daily", TargetValue: 10, TargetUnit: "分钟", RoutineKind: "evening"},
+	{Code: "daily_reading", Name: "每日阅读", Description: "每天读一点书，积少成多", Category: "reading", Icon: "📚", Frequency: "daily", TargetValue: 20, TargetUnit: "页", RoutineKind: "evening"},
+	{Code: "news_reading", Name: "阅读资讯", Description: "了解行业动态和新闻", Category: "reading", Icon: "📰", Frequency: "daily", TargetValue: 15, TargetUnit: "分钟", RoutineKind: "morning"},
+	{Code: "early_sleep", Name: "早睡", Description: "23:00 前上床睡觉", Category: "sleep", Icon: "😴", Frequency: "daily", TargetValue: 8, TargetUnit: "小时", RoutineKind: "evening"},
+	{Code: "no_screen", Name: "睡前不看手机", Description: "睡前 30 分钟远离屏幕", Category: "sleep", Icon: "📵", Frequency: "daily", TargetValue: 30, TargetUnit: "分钟", RoutineKind: "evening"},
+	{Code: "drink_water", Name: "多喝水", Description: "每天喝足 8 杯水", Category: "hydration", Icon: "💧", Frequency: "daily", TargetValue: 8, TargetUnit: "杯"},
+	{Code: "morning_water", Name: "晨起一杯水", Description: "起床后先喝一杯温水", Category: "hydration", Icon: "🥛", Frequency: "daily", TargetValue: 1, TargetUnit: "杯", RoutineKind: "morning"},
+}
+
+// defaultTodoColumns is the board workflow every user starts with
+var defaultTodoColumns = []models.TodoColumn{
+	{Name: "待办", Color: "#64748B"},
+	{Name: "进行中", Color: "#3B82F6", WIPLimit: 3},
+	{Name: "阻塞", Color: "#EF4444"},
+	{Name: "已完成", Color: "#10B981", IsDone: true},
+}
+
+// CreateUserTodoColumns creates the default board columns for a user who has
+// none yet; users who already set up their board are left alone.
+func CreateUserTodoColumns(userID int) {
 	var count int
-	DB.QueryRow("SELECT COUNT(*) FROM badges WHERE user_id = ?", userID).Scan(&count)
+	if err := DB.QueryRow("SELECT COUNT(*) FROM todo_columns WHERE user_id = ?", userID).Scan(&count); err != nil {
+		log.Println("Error checking todo columns:", err)
+		return
+	}
 	if count > 0 {
 		return
 	}
 
-	badges := []struct {
-		Name        string
-		Description string
-		Icon        string
-		Days        int
-	}{
-		{"初出茅庐", "完成第一次打卡", "🌱", 1},
-		{"坚持不懈", "累计打卡7天", "🔥", 7},
-		{"习惯养成", "累计打卡21天", "⭐", 21},
-		{"自律大师", "累计打卡100天", "👑", 100},
+	for i, c := range defaultTodoColumns {
+		isDone := 0
+		if c.IsDone {
+			isDone = 1
+		}
+		_, err := DB.Exec("INSERT INTO todo_columns (user_id, name, color, wip_limit, is_done, sort_order) VALUES (?, ?, ?, ?, ?, ?)",
+			userID, c.Name, c.Color, c.WIPLimit, isDone, i+1)
+		if err != nil {
+			log.Println("Error creating default todo columns:", err)
+			return
+		}
 	}
+}
 
-	for _, b := range badges {
-		_, err := DB.Exec("INSERT INTO badges (user_id, name, description, icon, condition_days) VALUES (?, ?, ?, ?, ?)", userID, b.Name, b.Description, b.Icon, b.Days)
-		if err != nil {
-			log.Println("Error creating user badges:", err)
+// CreateMissingTodoColumns creates the default board columns for every user
+// without any, e.g. users from before the board existed or from an import
+func CreateMissingTodoColumns() {
+	rows, err := DB.Query("SELECT id FROM users u WHERE NOT EXISTS (SELECT 1 FROM todo_columns c WHERE c.user_id = u.id)")
+	if err != nil {
+		log.Println("Error finding users without todo columns:", err)
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
 		}
 	}
+	rows.Close()
+
+	for _, id := range userIDs {
+		CreateUserTodoColumns(id)
+	}
 }
 
-func seedBadges() {
-	// Badges are now created per user, so this function is deprecated
-	// We'll create badges when users register instead
-	log.Println("Badges will be created per user upon registration")
+func seedHabitTemplates() {
+	for i, t := range defaultHabitTemplates {
+		_, err := DB.Exec(
+			"INSERT IGNORE INTO habit_templates (code, name, description, category, icon, frequency, target_value, target_unit, routine_kind, sort_order) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			t.Code, t.Name, t.Description, t.Category, t.Icon, t.Frequency, t.TargetValue, t.TargetUnit, t.RoutineKind, i+1,
+		)
+		if err != nil {
+			log.Println("Error seeding habit templates:", err)
+		}
+	}
 }
 
 func seedCategories() {
@@ -379,9 +650,91 @@ func migrateDatabase() {
 		}
 	}
 
+	// Columns added after the first release
+	addColumnIfMissing("badges", "code", "VARCHAR(64)")
+	addColumnIfMissing("badges", "unlocked_at", "DATETIME NULL")
+	addColumnIfMissing("habits", "archived_at", "DATETIME NULL")
+	addColumnIfMissing("habits", "routine_id", "INT NULL")
+	addColumnIfMissing("habits", "sort_order", "INT DEFAULT 0")
+	addColumnIfMissing("habits", "target_value", "INT DEFAULT 0")
+	addColumnIfMissing("habits", "target_unit", "VARCHAR(20) DEFAULT ''")
+	addColumnIfMissing("todos", "priority", "INT DEFAULT 0")
+	addColumnIfMissing("todos", "project_id", "INT NULL")
+	addColumnIfMissing("todos", "parent_id", "INT NULL")
+	addColumnIfMissing("todos", "recurrence_rule", "VARCHAR(50) DEFAULT ''")
+	addColumnIfMissing("todos", "series_id", "INT NULL")
+	addColumnIfMissing("todos", "tags", "VARCHAR(255) DEFAULT ''")
+	addColumnIfMissing("todos", "column_id", "INT NULL")
+	addColumnIfMissing("todos", "board_order", "INT DEFAULT 0")
+	addColumnIfMissing("todos", "completed_at", "DATETIME NULL")
+	addColumnIfMissing("todos", "ical_uid", "VARCHAR(255) DEFAULT ''")
+	addColumnIfMissing("users", "calendar_token", "VARCHAR(64) NULL UNIQUE")
+	addColumnIfMissing("users", "diary_digest", "TINYINT DEFAULT 0")
+	addColumnIfMissing("users", "diary_key_salt", "VARCHAR(64) NULL")
+	addColumnIfMissing("users", "diary_key_check", "VARCHAR(255) NULL")
+	addColumnIfMissing("diaries", "encrypted", "TINYINT DEFAULT 0")
+	addColumnIfMissing("diary_revisions", "encrypted", "TINYINT DEFAULT 0")
+	addColumnIfMissing("habit_logs", "note", "VARCHAR(500) DEFAULT ''")
+	addColumnIfMissing("habit_logs", "mood", "VARCHAR(16) DEFAULT ''")
+	addColumnIfMissing("habit_logs", "duration_minutes", "INT DEFAULT 0")
+
+	// 日记全文检索，ngram 分词支持中文；不写进 CREATE TABLE，没有 ngram 插件时
+	// 只会记录错误，建表照常进行，搜索退回 LIKE 查询
+	addIndexIfMissing("diaries", "ft_diaries_title_content", "FULLTEXT INDEX ft_diaries_title_content (title, content) WITH PARSER ngram")
+
 	log.Println("Database migration completed for MySQL")
 }
 
+// addColumnIfMissing adds a column to an existing table when it isn't there yet
+func addColumnIfMissing(table, column, definition string) {
+	var exists bool
+	err := DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE()
+		AND table_name = ?
+		AND column_name = ?
+	`, table, column).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking column %s.%s: %v", table, column, err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	log.Printf("Adding column %s to %s table...", column, table)
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		log.Printf("Error adding column %s.%s: %v", table, column, err)
+	}
+}
+
+// addIndexIfMissing adds an index to an existing table when it isn't there yet
+func addIndexIfMissing(table, index, definition string) {
+	var exists bool
+	err := DB.QueryRow(`
+		SELECT COUNT(*) > 0
+		FROM information_schema.statistics
+		WHERE table_schema = DATABASE()
+		AND table_name = ?
+		AND index_name = ?
+	`, table, index).Scan(&exists)
+	if err != nil {
+		log.Printf("Error checking index %s.%s: %v", table, index, err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	log.Printf("Adding index %s to %s table...", index, table)
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", table, definition))
+	if err != nil {
+		log.Printf("Error adding index %s.%s: %v", table, index, err)
+	}
+}
+
 func verifyCategories() {
 	// Check if categories table exists
 	var tableExists bool
@@ -431,14 +784,23 @@ func ClearAllData() error {
 	// Clear data from all tables
 	tables := []string{
 		"todo_checkins",
+		"todo_sessions",
 		"todos",
+		"todo_projects",
+		"todo_columns",
+		"habit_pauses",
 		"habit_logs",
 		"habits",
+		"habit_routines",
 		"transactions",
 		"finance_goals",
+		"diary_drafts",
+		"diary_revisions",
 		"diaries",
 		"categories",
+		"badge_unlocks",
 		"badges",
+		"notifications",
 		"users",
 	}
 
@@ -408,6 +408,9 @@ func importDatabaseData(file multipart.File, importOption string) error {
 		return fmt.Errorf("提交事务失败: %w", err)
 	}
 
+	// 导入的用户没有看板列，补上默认列
+	db.CreateMissingTodoColumns()
+
 	return nil
 }
 
@@ -517,7 +520,7 @@ func exportDiaryData(tx *sql.Tx, data map[string]interface{}) error {
 // 导入辅助函数
 func clearDatabaseData(tx *sql.Tx) error {
 	// 按顺序删除数据
-	tables := []string{"badges", "diaries", "todo_checkins", "todos", "habit_logs", "habits", "transactions", "users"}
+	tables := []string{"notifications", "badge_unlocks", "badges", "diary_drafts", "diary_revisions", "diaries", "todo_checkins", "todo_sessions", "todos", "todo_projects", "todo_columns", "habit_pauses", "habit_logs", "habits", "habit_routines", "transactions", "users"}
 	for _, table := range tables {
 		_, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table))
 		if err != nil {
@@ -536,6 +539,8 @@ func importDataToDatabase(tx *sql.Tx, data map[string]interface{}) error {
 				username, _ := userMap["username"].(string)
 				email, _ := userMap["email"].(string)
 				password, _ := userMap["password"].(string)
+				keySalt, _ := userMap["diary_key_salt"].(string)
+				keyCheck, _ := userMap["diary_key_check"].(string)
 				
 				// 检查用户是否已存在
 				var exists bool
@@ -547,8 +552,10 @@ func importDataToDatabase(tx *sql.Tx, data map[string]interface{}) error {
 				if !exists {
 					// 插入新用户
 					_, err := tx.Exec(
-						"INSERT INTO users (username, email, password, created_at) VALUES (?, ?, ?, ?)",
-						username, email, password, time.Now(),
+						"INSERT INTO users (username, email, password, diary_key_salt, diary_key_check, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+						username, email, password,
+						sql.NullString{String: keySalt, Valid: keySalt != ""}, sql.NullString{String: keyCheck, Valid: keyCheck != ""},
+						time.Now(),
 					)
 					if err != nil {
 						return fmt.Errorf("插入用户失败: %w", err)
@@ -703,10 +710,12 @@ func importDataToDatabase(tx *sql.Tx, data map[string]interface{}) error {
 				weather, _ := diaryMap["weather"].(string)
 				mood, _ := diaryMap["mood"].(string)
 				
+				encrypted, _ := diaryMap["encrypted"].(bool)
+				
 				// 插入日记
 				_, err := tx.Exec(
-					"INSERT INTO diaries (user_id, title, content, weather, mood, date, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-					int(userID), title, content, weather, mood, time.Now(), time.Now(), time.Now(),
+					"INSERT INTO diaries (user_id, title, content, weather, mood, date, encrypted, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+					int(userID), title, content, weather, mood, time.Now(), encrypted, time.Now(), time.Now(),
 				)
 				if err != nil {
 					return fmt.Errorf("插入日记失败: %w", err)
@@ -720,7 +729,7 @@ func importDataToDatabase(tx *sql.Tx, data map[string]interface{}) error {
 
 // 数据库查询辅助函数
 func getAllUsersFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
-	rows, err := tx.Query("SELECT id, username, email, password, created_at FROM users")
+	rows, err := tx.Query("SELECT id, username, email, password, diary_key_salt, diary_key_check, created_at FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -730,16 +739,20 @@ func getAllUsersFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
 	for rows.Next() {
 		var id int
 		var username, email, password string
+		var keySalt, keyCheck sql.NullString
 		var createdAt time.Time
-		if err := rows.Scan(&id, &username, &email, &password, &createdAt); err != nil {
+		if err := rows.Scan(&id, &username, &email, &password, &keySalt, &keyCheck, &createdAt); err != nil {
 			return nil, err
 		}
+		// 私密日记口令的盐和校验值，导入后用户仍能用原口令解锁
 		user := map[string]interface{}{
-			"id":         id,
-			"username":   username,
-			"email":      email,
-			"password":   password,
-			"created_at": createdAt,
+			"id":              id,
+			"username":        username,
+			"email":           email,
+			"password":        password,
+			"diary_key_salt":  keySalt.String,
+			"diary_key_check": keyCheck.String,
+			"created_at":      createdAt,
 		}
 		users = append(users, user)
 	}
@@ -868,7 +881,7 @@ func getAllHabitsFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
 }
 
 func getAllHabitLogsFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
-	rows, err := tx.Query("SELECT id, habit_id, date FROM habit_logs")
+	rows, err := tx.Query("SELECT id, habit_id, date, COALESCE(note, ''), COALESCE(mood, ''), COALESCE(duration_minutes, 0) FROM habit_logs")
 	if err != nil {
 		return nil, err
 	}
@@ -876,15 +889,19 @@ func getAllHabitLogsFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
 
 	var logs []map[string]interface{}
 	for rows.Next() {
-		var id, habitID int
+		var id, habitID, duration int
 		var date time.Time
-		if err := rows.Scan(&id, &habitID, &date); err != nil {
+		var note, mood string
+		if err := rows.Scan(&id, &habitID, &date, &note, &mood, &duration); err != nil {
 			return nil, err
 		}
 		log := map[string]interface{}{
-			"id":       id,
-			"habit_id": habitID,
-			"date":     date,
+			"id":               id,
+			"habit_id":         habitID,
+			"date":             date,
+			"note":             note,
+			"mood":             mood,
+			"duration_minutes": duration,
 		}
 		logs = append(logs, log)
 	}
@@ -945,7 +962,7 @@ func getAllTodoCheckinsFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
 }
 
 func getAllDiariesFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
-	rows, err := tx.Query("SELECT id, user_id, title, content, weather, mood, date, created_at, updated_at FROM diaries")
+	rows, err := tx.Query("SELECT id, user_id, title, content, weather, mood, date, encrypted, created_at, updated_at FROM diaries")
 	if err != nil {
 		return nil, err
 	}
@@ -955,10 +972,12 @@ func getAllDiariesFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
 	for rows.Next() {
 		var id, userID int
 		var title, content, weather, mood string
+		var encrypted bool
 		var date, createdAt, updatedAt time.Time
-		if err := rows.Scan(&id, &userID, &title, &content, &weather, &mood, &date, &createdAt, &updatedAt); err != nil {
+		if err := rows.Scan(&id, &userID, &title, &content, &weather, &mood, &date, &encrypted, &createdAt, &updatedAt); err != nil {
 			return nil, err
 		}
+		// 私密日记的 content 是密文，原样导出，只有用户自己的口令能解开
 		diary := map[string]interface{}{
 			"id":         id,
 			"user_id":    userID,
@@ -967,6 +986,7 @@ func getAllDiariesFromDB(tx *sql.Tx) ([]map[string]interface{}, error) {
 			"weather":    weather,
 			"mood":       mood,
 			"date":       date,
+			"encrypted":  encrypted,
 			"created_at": createdAt,
 			"updated_at": updatedAt,
 		}
@@ -1002,6 +1022,13 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 删除用户相关数据
 	// 1. 删除用户的徽章
+	_, err = tx.Exec("DELETE FROM badge_unlocks WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户徽章解锁记录失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	_, err = tx.Exec("DELETE FROM badges WHERE user_id = ?", userID)
 	if err != nil {
 		log.Printf("删除用户徽章失败: %v", err)
@@ -1010,6 +1037,20 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. 删除用户的日记
+	_, err = tx.Exec("DELETE FROM diary_drafts WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户日记草稿失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM diary_revisions WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户日记历史版本失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	_, err = tx.Exec("DELETE FROM diaries WHERE user_id = ?", userID)
 	if err != nil {
 		log.Printf("删除用户日记失败: %v", err)
@@ -1025,6 +1066,13 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, err = tx.Exec("DELETE FROM todo_sessions WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户待办计时记录失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	_, err = tx.Exec("DELETE FROM todos WHERE user_id = ?", userID)
 	if err != nil {
 		log.Printf("删除用户待办事项失败: %v", err)
@@ -1032,7 +1080,28 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, err = tx.Exec("DELETE FROM todo_projects WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户待办项目失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM todo_columns WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户看板列失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	// 4. 删除用户的习惯
+	_, err = tx.Exec("DELETE FROM habit_pauses WHERE habit_id IN (SELECT id FROM habits WHERE user_id = ?)", userID)
+	if err != nil {
+		log.Printf("删除用户习惯暂停记录失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	_, err = tx.Exec("DELETE FROM habit_logs WHERE habit_id IN (SELECT id FROM habits WHERE user_id = ?)", userID)
 	if err != nil {
 		log.Printf("删除用户习惯记录失败: %v", err)
@@ -1047,6 +1116,13 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, err = tx.Exec("DELETE FROM habit_routines WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户习惯分组失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	// 5. 删除用户的交易记录
 	_, err = tx.Exec("DELETE FROM transactions WHERE user_id = ?", userID)
 	if err != nil {
@@ -1055,7 +1131,15 @@ func AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 6. 最后删除用户本身
+	// 6. 删除用户的通知
+	_, err = tx.Exec("DELETE FROM notifications WHERE user_id = ?", userID)
+	if err != nil {
+		log.Printf("删除用户通知失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 7. 最后删除用户本身
 	result, err := tx.Exec("DELETE FROM users WHERE id = ?", userID)
 	if err != nil {
 		log.Printf("删除用户失败: %v", err)
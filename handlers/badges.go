@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+// badgeMetric computes the value a badge rule compares against its threshold
+type badgeMetric func(userID int) (float64, error)
+
+// badgeRule describes how a rule type is evaluated and explained to the user
+type badgeRule struct {
+	module string // module the badge belongs to, used by the achievements page
+	reason string // fmt format for the unlock reason, receives the metric value
+	metric badgeMetric
+}
+
+// badgeRules maps every rule type in badge_definitions to its metric.
+// Adding a new kind of badge means adding a rule here and rows to the registry.
+var badgeRules = map[string]badgeRule{
+	models.BadgeRuleHabitStreak:    {"habits", "单个习惯连续打卡 %.0f 天", habitStreakMetric},
+	models.BadgeRuleHabitCheckins:  {"habits", "习惯累计打卡 %.0f 次", habitCheckinsMetric},
+	models.BadgeRuleDiaryStreak:    {"diary", "连续写日记 %.0f 天", diaryStreakMetric},
+	models.BadgeRuleTodoCompletion: {"todos", "累计完成 %.0f 个待办", todoCompletionsMetric},
+	models.BadgeRuleSavings:        {"finance", "累计结余达到 %.2f 元", savingsMetric},
+}
+
+// badgeModules lists badge modules in display order
+var badgeModules = []struct {
+	Key  string
+	Name string
+}{
+	{"habits", "习惯打卡"},
+	{"diary", "我的日记"},
+	{"todos", "日程待办"},
+	{"finance", "收支管理"},
+}
+
+// badgeModuleName returns the display name of a badge module
+func badgeModuleName(module string) string {
+	for _, m := range badgeModules {
+		if m.Key == module {
+			return m.Name
+		}
+	}
+	return "其他"
+}
+
+// EvaluateBadges checks the user's locked badges against their rules and
+// unlocks the ones that are reached. It returns the newly unlocked badges.
+// Call it after any event that can move a metric (check-ins, diaries, todos, transactions).
+func EvaluateBadges(userID int) []models.Badge {
+	if db.DB == nil {
+		return nil
+	}
+
+	type candidate struct {
+		badge     models.Badge
+		ruleType  string
+		threshold int
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT b.id, b.code, b.name, b.description, b.icon, d.rule_type, d.threshold
+		FROM badges b
+		INNER JOIN badge_definitions d ON b.code = d.code
+		WHERE b.user_id = ? AND b.unlocked = 0 AND d.is_active = 1
+	`, userID)
+	if err != nil {
+		log.Printf("Error loading locked badges: %v", err)
+		return nil
+	}
+
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.badge.ID, &c.badge.Code, &c.badge.Name, &c.badge.Description, &c.badge.Icon, &c.ruleType, &c.threshold); err != nil {
+			log.Printf("Error scanning badge: %v", err)
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	// 每种规则只计算一次
+	metrics := make(map[string]float64)
+	var unlocked []models.Badge
+	now := time.Now()
+
+	for _, c := range candidates {
+		rule, known := badgeRules[c.ruleType]
+		if !known {
+			log.Printf("Unknown badge rule type %q for badge %s", c.ruleType, c.badge.Code)
+			continue
+		}
+
+		value, ok := metrics[c.ruleType]
+		if !ok {
+			value, err = rule.metric(userID)
+			if err != nil {
+				log.Printf("Error evaluating badge rule %s: %v", c.ruleType, err)
+				continue
+			}
+			metrics[c.ruleType] = value
+		}
+
+		if value < float64(c.threshold) {
+			continue
+		}
+
+		result, err := db.DB.Exec("UPDATE badges SET unlocked = 1, unlocked_at = ? WHERE id = ? AND user_id = ? AND unlocked = 0", now, c.badge.ID, userID)
+		if err != nil {
+			log.Printf("Error unlocking badge %s: %v", c.badge.Code, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			c.badge.Unlocked = true
+			c.badge.UnlockedAt = now
+			unlocked = append(unlocked, c.badge)
+			log.Printf("User %d unlocked badge %s", userID, c.badge.Code)
+
+			// 记录解锁原因，供下次页面加载时提示和成就时间线使用
+			_, err = db.DB.Exec("INSERT INTO badge_unlocks (user_id, badge_id, reason, metric_value, unlocked_at) VALUES (?, ?, ?, ?, ?)",
+				userID, c.badge.ID, fmt.Sprintf(rule.reason, value), value, now)
+			if err != nil {
+				log.Printf("Error recording badge unlock %s: %v", c.badge.Code, err)
+			}
+		}
+	}
+
+	return unlocked
+}
+
+// AchievementsHandler renders the achievements timeline across all modules
+func AchievementsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user session for display
+	session, _ := auth.ValidateSession(r)
+
+	type moduleSummary struct {
+		Name     string
+		Unlocked int
+		Total    int
+	}
+
+	data := struct {
+		ActivePage  string
+		Timeline    []models.BadgeUnlock
+		Locked      []models.Badge
+		Modules     []moduleSummary
+		TotalBadges int
+		User        *auth.Session
+		IsLoggedIn  bool
+	}{
+		ActivePage: "achievements",
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT b.id, COALESCE(b.code, ''), b.name, b.description, b.icon, b.unlocked,
+			COALESCE(d.rule_type, ''), COALESCE(u.reason, ''), COALESCE(u.unlocked_at, b.unlocked_at)
+		FROM badges b
+		LEFT JOIN badge_definitions d ON b.code = d.code
+		LEFT JOIN badge_unlocks u ON u.badge_id = b.id
+		WHERE b.user_id = ?
+		ORDER BY b.unlocked DESC, COALESCE(u.unlocked_at, b.unlocked_at) DESC, b.id
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching achievements: %v", err)
+		renderTemplate(w, "achievements.html", data)
+		return
+	}
+	defer rows.Close()
+
+	counts := make(map[string]*moduleSummary)
+	for rows.Next() {
+		var u models.BadgeUnlock
+		var unlocked int
+		var ruleType string
+		var unlockedAt sql.NullTime
+		if err := rows.Scan(&u.BadgeID, &u.Code, &u.Name, &u.Description, &u.Icon, &unlocked, &ruleType, &u.Reason, &unlockedAt); err != nil {
+			log.Printf("Error scanning achievement: %v", err)
+			continue
+		}
+		u.Module = badgeRules[ruleType].module
+		u.ModuleName = badgeModuleName(u.Module)
+		if unlockedAt.Valid {
+			u.UnlockedAt = unlockedAt.Time
+		}
+
+		summary, exists := counts[u.Module]
+		if !exists {
+			summary = &moduleSummary{Name: u.ModuleName}
+			counts[u.Module] = summary
+		}
+		summary.Total++
+		data.TotalBadges++
+
+		if unlocked == 1 {
+			summary.Unlocked++
+			data.Timeline = append(data.Timeline, u)
+		} else {
+			data.Locked = append(data.Locked, models.Badge{ID: u.BadgeID, Code: u.Code, Name: u.Name, Description: u.Description, Icon: u.Icon})
+		}
+	}
+	for _, m := range badgeModules {
+		if summary, exists := counts[m.Key]; exists {
+			data.Modules = append(data.Modules, *summary)
+		}
+	}
+	if summary, exists := counts[""]; exists {
+		data.Modules = append(data.Modules, *summary)
+	}
+
+	renderTemplate(w, "achievements.html", data)
+}
+
+// UnseenBadgesHandler returns badge unlocks the user hasn't been told about yet
+// and marks them as notified, so each toast is shown only once.
+func UnseenBadgesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	unseen := []models.BadgeUnlock{}
+	rows, err := db.DB.Query(`
+		SELECT u.id, u.badge_id, COALESCE(b.code, ''), b.name, b.description, b.icon, COALESCE(u.reason, ''), u.unlocked_at
+		FROM badge_unlocks u
+		INNER JOIN badges b ON u.badge_id = b.id
+		WHERE u.user_id = ? AND u.notified = 0
+		ORDER BY u.unlocked_at
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching unseen badges: %v", err)
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var u models.BadgeUnlock
+			if err := rows.Scan(&u.ID, &u.BadgeID, &u.Code, &u.Name, &u.Description, &u.Icon, &u.Reason, &u.UnlockedAt); err != nil {
+				log.Printf("Error scanning unseen badge: %v", err)
+				continue
+			}
+			unseen = append(unseen, u)
+		}
+	}
+
+	for _, u := range unseen {
+		_, err := db.DB.Exec("UPDATE badge_unlocks SET notified = 1 WHERE id = ? AND user_id = ?", u.ID, userID)
+		if err != nil {
+			log.Printf("Error marking badge unlock notified: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(unseen)
+}
+
+func habitStreakMetric(userID int) (float64, error) {
+	var streak sql.NullInt64
+	err := db.DB.QueryRow("SELECT MAX(streak) FROM habits WHERE user_id = ?", userID).Scan(&streak)
+	return float64(streak.Int64), err
+}
+
+func habitCheckinsMetric(userID int) (float64, error) {
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id WHERE h.user_id = ?", userID).Scan(&count)
+	return float64(count), err
+}
+
+// diaryStreakMetric returns the longest run of consecutive days with a diary entry
+func diaryStreakMetric(userID int) (float64, error) {
+	rows, err := db.DB.Query("SELECT DISTINCT DATE(date) FROM diaries WHERE user_id = ? ORDER BY DATE(date)", userID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	longest, current := 0, 0
+	var prev time.Time
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return 0, err
+		}
+		if !prev.IsZero() && prev.AddDate(0, 0, 1).Equal(day) {
+			current++
+		} else {
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+		prev = day
+	}
+	return float64(longest), rows.Err()
+}
+
+func todoCompletionsMetric(userID int) (float64, error) {
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE user_id = ? AND status = 'completed'", userID).Scan(&count)
+	return float64(count), err
+}
+
+func savingsMetric(userID int) (float64, error) {
+	var savings float64
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN type = 'income' THEN amount ELSE -amount END), 0)
+		FROM transactions
+		WHERE user_id = ? AND type IN ('income', 'expense')
+	`, userID).Scan(&savings)
+	return savings, err
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// calendarModule is a data source that can be toggled on the calendar
+type calendarModule struct {
+	Key   string
+	Label string
+	Color string
+	Icon  string
+}
+
+var calendarModules = []calendarModule{
+	{Key: "todos", Label: "待办", Color: "#F59E0B", Icon: "fa-list-ul"},
+	{Key: "habits", Label: "习惯打卡", Color: "#10B981", Icon: "fa-check-circle"},
+	{Key: "diary", Label: "日记", Color: "#8B5CF6", Icon: "fa-book"},
+	{Key: "finance", Label: "收支", Color: "#3B82F6", Icon: "fa-wallet"},
+}
+
+var calendarViews = []struct {
+	Key   string
+	Label string
+}{
+	{"month", "月"},
+	{"week", "周"},
+	{"day", "日"},
+}
+
+// CalendarHandler shows todos, habit check-ins, diary entries and
+// transactions on one month, week or day view
+func CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user session
+	session, _ := auth.ValidateSession(r)
+
+	query := r.URL.Query()
+	view := query.Get("view")
+	if view != "week" && view != "day" {
+		view = "month"
+	}
+	now := time.Now()
+	date := now
+	if parsed, err := time.ParseInLocation("2006-01-02", query.Get("date"), time.Local); err == nil {
+		date = parsed
+	}
+	modules := parseCalendarModules(query)
+
+	start, end := calendarRange(view, date)
+	events := loadCalendarEvents(userID, start, end, modules)
+
+	// 按天分组
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var days []models.CalendarDay
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		cell := models.CalendarDay{
+			Date:    day,
+			URL:     calendarURL("day", day, modules),
+			InRange: view != "month" || day.Month() == date.Month(),
+			IsToday: day.Equal(today),
+		}
+		next := day.AddDate(0, 0, 1)
+		for _, e := range events {
+			if !e.Start.Before(day) && e.Start.Before(next) {
+				cell.Events = append(cell.Events, e)
+			}
+		}
+		days = append(days, cell)
+	}
+
+	var prev, next time.Time
+	var title string
+	switch view {
+	case "day":
+		prev, next = date.AddDate(0, 0, -1), date.AddDate(0, 0, 1)
+		title = fmt.Sprintf("%d年%d月%d日 星期%s", date.Year(), date.Month(), date.Day(), weekdayNames[date.Weekday()])
+	case "week":
+		prev, next = date.AddDate(0, 0, -7), date.AddDate(0, 0, 7)
+		last := end.AddDate(0, 0, -1)
+		title = fmt.Sprintf("%d年%d月%d日 - %d月%d日", start.Year(), start.Month(), start.Day(), last.Month(), last.Day())
+	default:
+		first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.Local)
+		prev, next = first.AddDate(0, -1, 0), first.AddDate(0, 1, 0)
+		title = fmt.Sprintf("%d年%d月", date.Year(), date.Month())
+	}
+
+	type moduleToggle struct {
+		calendarModule
+		Enabled bool
+	}
+	var toggles []moduleToggle
+	for _, m := range calendarModules {
+		toggles = append(toggles, moduleToggle{m, modules[m.Key]})
+	}
+	type viewLink struct {
+		Key, Label, URL string
+		Active          bool
+	}
+	var views []viewLink
+	for _, v := range calendarViews {
+		views = append(views, viewLink{v.Key, v.Label, calendarURL(v.Key, date, modules), v.Key == view})
+	}
+
+	data := struct {
+		ActivePage string
+		View       string
+		Date       string
+		Title      string
+		Days       []models.CalendarDay
+		Weekdays   []string
+		Modules    []moduleToggle
+		Views      []viewLink
+		PrevURL    string
+		NextURL    string
+		TodayURL   string
+		EventCount int
+		User       *auth.Session
+		IsLoggedIn bool
+	}{
+		ActivePage: "calendar",
+		View:       view,
+		Date:       date.Format("2006-01-02"),
+		Title:      title,
+		Days:       days,
+		Weekdays:   []string{"一", "二", "三", "四", "五", "六", "日"},
+		Modules:    toggles,
+		Views:      views,
+		PrevURL:    calendarURL(view, prev, modules),
+		NextURL:    calendarURL(view, next, modules),
+		TodayURL:   calendarURL(view, now, modules),
+		EventCount: len(events),
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	renderTemplate(w, "calendar.html", data)
+}
+
+// CalendarEventsHandler returns the calendar events in [start, end) as JSON.
+// start and end are dates (2006-01-02); module limits the sources and may be
+// repeated.
+func CalendarEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	start, err := time.ParseInLocation("2006-01-02", query.Get("start"), time.Local)
+	if err != nil {
+		http.Error(w, "start 格式应为 YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", query.Get("end"), time.Local)
+	if err != nil || !end.After(start) {
+		http.Error(w, "end 格式应为 YYYY-MM-DD 且晚于 start", http.StatusBadRequest)
+		return
+	}
+	if end.Sub(start) > 366*24*time.Hour {
+		http.Error(w, "时间范围不能超过一年", http.StatusBadRequest)
+		return
+	}
+
+	events := loadCalendarEvents(userID, start, end, parseCalendarModules(query))
+	if events == nil {
+		events = []models.CalendarEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// parseCalendarModules returns the enabled modules. Without any module
+// parameter every module is enabled; filtered=1 marks an explicit (possibly
+// empty) selection.
+func parseCalendarModules(query url.Values) map[string]bool {
+	selected := query["module"]
+	enabled := make(map[string]bool)
+	for _, m := range calendarModules {
+		enabled[m.Key] = len(selected) == 0 && query.Get("filtered") == ""
+	}
+	for _, key := range selected {
+		if _, ok := enabled[key]; ok {
+			enabled[key] = true
+		}
+	}
+	return enabled
+}
+
+// calendarRange returns the days shown by a view: the weeks covering the
+// month, the week (Monday first) or the single day
+func calendarRange(view string, date time.Time) (time.Time, time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	mondayOf := func(t time.Time) time.Time {
+		return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	}
+	switch view {
+	case "day":
+		return day, day.AddDate(0, 0, 1)
+	case "week":
+		start := mondayOf(day)
+		return start, start.AddDate(0, 0, 7)
+	default:
+		first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.Local)
+		start := mondayOf(first)
+		end := mondayOf(first.AddDate(0, 1, 0))
+		if end.Before(first.AddDate(0, 1, 0)) {
+			end = end.AddDate(0, 0, 7)
+		}
+		return start, end
+	}
+}
+
+// calendarURL links to a calendar view, keeping the module selection
+func calendarURL(view string, date time.Time, modules map[string]bool) string {
+	values := url.Values{}
+	values.Set("view", view)
+	values.Set("date", date.Format("2006-01-02"))
+	all := true
+	for _, m := range calendarModules {
+		if modules[m.Key] {
+			values.Add("module", m.Key)
+		} else {
+			all = false
+		}
+	}
+	if all {
+		values.Del("module")
+	} else {
+		values.Set("filtered", "1")
+	}
+	return "/calendar?" + values.Encode()
+}
+
+// loadCalendarEvents loads the user's events in [start, end) from the enabled
+// modules, ordered by time
+func loadCalendarEvents(userID int, start, end time.Time, modules map[string]bool) []models.CalendarEvent {
+	var events []models.CalendarEvent
+	colors := make(map[string]calendarModule)
+	for _, m := range calendarModules {
+		colors[m.Key] = m
+	}
+	add := func(module, id, title string, at time.Time, allDay, done bool, link string) {
+		m := colors[module]
+		events = append(events, models.CalendarEvent{
+			ID: module + "-" + id, Module: module, Title: title, Start: at, AllDay: allDay,
+			Color: m.Color, Icon: m.Icon, URL: link, Done: done,
+		})
+	}
+
+	if modules["todos"] {
+		rows, err := db.DB.Query(`
+			SELECT id, content, due_date, status
+			FROM todos
+			WHERE user_id = ? AND due_date >= ? AND due_date < ?
+			ORDER BY due_date
+		`, userID, start, end)
+		if err != nil {
+			log.Printf("Error fetching calendar todos: %v", err)
+		} else {
+			for rows.Next() {
+				var id int
+				var content, status string
+				var due time.Time
+				if err := rows.Scan(&id, &content, &due, &status); err == nil {
+					add("todos", fmt.Sprint(id), content, due, false, status == "completed", fmt.Sprintf("/todos/checkins?id=%d", id))
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	if modules["habits"] {
+		rows, err := db.DB.Query(`
+			SELECT hl.id, h.id, h.name, hl.date
+			FROM habit_logs hl
+			INNER JOIN habits h ON hl.habit_id = h.id
+			WHERE h.user_id = ? AND hl.date >= ? AND hl.date < ?
+			ORDER BY hl.date
+		`, userID, start, end)
+		if err != nil {
+			log.Printf("Error fetching calendar habit logs: %v", err)
+		} else {
+			for rows.Next() {
+				var id, habitID int
+				var name string
+				var date time.Time
+				if err := rows.Scan(&id, &habitID, &name, &date); err == nil {
+					add("habits", fmt.Sprint(id), name, date, true, true, fmt.Sprintf("/habits#habit-%d", habitID))
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	if modules["diary"] {
+		rows, err := db.DB.Query(`
+			SELECT id, title, mood, date
+			FROM diaries
+			WHERE user_id = ? AND date >= ? AND date < ?
+			ORDER BY date
+		`, userID, start, end)
+		if err != nil {
+			log.Printf("Error fetching calendar diaries: %v", err)
+		} else {
+			for rows.Next() {
+				var id int
+				var title, mood sql.NullString
+				var date time.Time
+				if err := rows.Scan(&id, &title, &mood, &date); err == nil {
+					label := title.String
+					if label == "" {
+						label = "无标题日记"
+					}
+					if mood.String != "" {
+						label = mood.String + " " + label
+					}
+					add("diary", fmt.Sprint(id), label, date, true, false, fmt.Sprintf("/diary?view=%d", id))
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	if modules["finance"] {
+		rows, err := db.DB.Query(`
+			SELECT id, type, COALESCE(category, ''), amount, date
+			FROM transactions
+			WHERE user_id = ? AND date >= ? AND date < ?
+			ORDER BY date
+		`, userID, start, end)
+		if err != nil {
+			log.Printf("Error fetching calendar transactions: %v", err)
+		} else {
+			for rows.Next() {
+				var id int
+				var kind, category string
+				var amount float64
+				var date time.Time
+				if err := rows.Scan(&id, &kind, &category, &amount, &date); err == nil {
+					sign := "-"
+					if kind == "income" {
+						sign = "+"
+					}
+					add("finance", fmt.Sprint(id), fmt.Sprintf("%s¥%.2f %s", sign, amount, category), date, false, false, fmt.Sprintf("/finance#transaction-%d", id))
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	sortCalendarEvents(events)
+	return events
+}
+
+// sortCalendarEvents orders events by time; all-day events come first on
+// their day
+func sortCalendarEvents(events []models.CalendarEvent) {
+	key := func(e models.CalendarEvent) time.Time {
+		if e.AllDay {
+			return time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.Local)
+		}
+		return e.Start
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		ki, kj := key(events[i]), key(events[j])
+		if ki.Equal(kj) {
+			return events[i].AllDay && !events[j].AllDay
+		}
+		return ki.Before(kj)
+	})
+}
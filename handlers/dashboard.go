@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"goblog/auth"
 	"goblog/db"
+	"goblog/models"
 	"html/template"
 	"log"
 	"net/http"
@@ -41,6 +42,12 @@ func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
 			}
 			return aVal + bVal
 		},
+		"sub": func(a, b int) int {
+			return a - b
+		},
+		"unreadNotifications": unreadNotificationCount,
+		"duration":            formatDuration,
+		"markdownExcerpt":     markdownExcerpt,
 		"substr": func(s string, start, length int) string {
 			if start < 0 {
 				start = 0
@@ -93,6 +100,13 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 		TotalCount         int
 		HabitDoneCount     int
 		HabitMissedCount   int
+		TimeToday          int                // 今天的任务计时（秒）
+		TimeWeek           int                // 最近 7 天的任务计时（秒）
+		TimeByDay          []models.TimeTotal // 最近 7 天每天的计时
+		TimeByProject      []models.TimeTotal // 最近 30 天各项目的计时
+		TopTimedTodos      []models.TimeTotal // 最近 30 天用时最多的任务
+		TodoStats          models.TodoStats
+		Memories           []models.DiaryMemory // 那年今日
 		User               *auth.Session
 		IsLoggedIn         bool
 	}{
@@ -169,6 +183,12 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	if total > 0 {
 		data.TodoCompletionRate = (completed * 100) / total
 	}
+	data.TodoStats = loadTodoStats(userID, now)
+	if memories, err := loadDiaryMemories(userID, now); err != nil {
+		log.Printf("Error fetching diary memories: %v", err)
+	} else {
+		data.Memories = memories
+	}
 
 	// Chart Data (Last 6 months)
 	data.ChartMonths = make([]string, 6)
@@ -201,11 +221,11 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	// Habit Stats (Today) for current user
 	// Simple approximation: Habits done today vs Total habits
 	var totalHabits int
-	db.DB.QueryRow("SELECT COUNT(*) FROM habits WHERE user_id = ?", userID).Scan(&totalHabits)
+	db.DB.QueryRow("SELECT COUNT(*) FROM habits WHERE user_id = ? AND archived_at IS NULL", userID).Scan(&totalHabits)
 
 	var doneToday int
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
-	db.DB.QueryRow("SELECT COUNT(DISTINCT hl.habit_id) FROM habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id WHERE hl.date >= ? AND h.user_id = ?", startOfDay, userID).Scan(&doneToday)
+	db.DB.QueryRow("SELECT COUNT(DISTINCT hl.habit_id) FROM habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id WHERE hl.date >= ? AND h.user_id = ? AND h.archived_at IS NULL", startOfDay, userID).Scan(&doneToday)
 
 	data.HabitDoneCount = doneToday
 	data.HabitMissedCount = totalHabits - doneToday
@@ -214,5 +234,12 @@ func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 		data.HabitMissedCount = 0
 	}
 
+	// 任务计时统计
+	data.TimeByDay = todoTimeByDay(userID, 0, now.AddDate(0, 0, -6), 7)
+	data.TimeWeek = sumTimeTotals(data.TimeByDay)
+	data.TimeToday = data.TimeByDay[len(data.TimeByDay)-1].Seconds
+	data.TimeByProject = todoTimeByProject(userID, startOfDay.AddDate(0, 0, -29))
+	data.TopTimedTodos = todoTimeByTodo(userID, startOfDay.AddDate(0, 0, -29), 5)
+
 	renderTemplate(w, "dashboard.html", data)
 }
@@ -6,9 +6,10 @@ import (
 	"goblog/auth"
 	"goblog/db"
 	"goblog/models"
+	"html/template"
 	"log"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 )
 
@@ -26,7 +27,7 @@ func DiaryHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Get diaries from database for current user
 		rows, err := db.DB.Query(`
-			SELECT id, title, content, weather, mood, date, created_at, updated_at 
+			SELECT id, title, content, weather, mood, date, encrypted, created_at, updated_at 
 			FROM diaries 
 			WHERE user_id = ?
 			ORDER BY date DESC, created_at DESC
@@ -47,6 +48,7 @@ func DiaryHandler(w http.ResponseWriter, r *http.Request) {
 				&diary.Weather,
 				&diary.Mood,
 				&diary.Date,
+				&diary.Encrypted,
 				&diary.CreatedAt,
 				&diary.UpdatedAt,
 			)
@@ -56,6 +58,7 @@ func DiaryHandler(w http.ResponseWriter, r *http.Request) {
 			}
 			diaries = append(diaries, diary)
 		}
+		hideEncryptedContent(diaries)
 
 		// Group diaries by month
 		diaryGroups := make(map[string][]models.Diary)
@@ -76,6 +79,9 @@ func DiaryHandler(w http.ResponseWriter, r *http.Request) {
 			MonthCount    int
 			CurrentStreak int
 			TodayMood     string
+			Memories      []models.DiaryMemory
+			DigestEnabled bool
+			Encryption    diaryEncryption
 			ActivePage    string
 			User          *auth.Session
 			IsLoggedIn    bool
@@ -85,6 +91,9 @@ func DiaryHandler(w http.ResponseWriter, r *http.Request) {
 			MonthCount:    len(diaryGroups),
 			CurrentStreak: calculateCurrentStreak(diaries),
 			TodayMood:     getTodayMood(diaries),
+			Memories:      onThisDay(diaries, time.Now()),
+			DigestEnabled: diaryDigestEnabled(userID),
+			Encryption:    loadDiaryEncryption(r, userID),
 			ActivePage:    "diary",
 			User:          session,
 			IsLoggedIn:    session != nil,
@@ -207,6 +216,7 @@ func AddDiaryHandler(w http.ResponseWriter, r *http.Request) {
 		weather := r.FormValue("weather")
 		mood := r.FormValue("mood")
 		dateStr := r.FormValue("date")
+		encrypted := r.FormValue("encrypted") == "1"
 
 		log.Printf("收到日记数据 - 标题: %s, 内容长度: %d, 天气: %s, 心情: %s, 日期: %s",
 			title, len(content), weather, mood, dateStr)
@@ -243,10 +253,24 @@ func AddDiaryHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		result, err := db.DB.Exec(`
-		INSERT INTO diaries (user_id, title, content, weather, mood, date, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, userID, title, content, weather, mood, date, time.Now(), time.Now())
+		content, err := encryptDiaryContent(r, content, encrypted)
+		if err != nil {
+			writeDiaryEncryptError(w, err)
+			return
+		}
+
+		tx, err := db.DB.Begin()
+		if err != nil {
+			log.Printf("开始事务失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(`
+		INSERT INTO diaries (user_id, title, content, weather, mood, date, encrypted, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, title, content, weather, mood, date, encrypted, time.Now(), time.Now())
 
 		if err != nil {
 			log.Printf("数据库插入错误: %v", err)
@@ -255,8 +279,32 @@ func AddDiaryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		id, _ := result.LastInsertId()
+
+		// 第一个历史版本
+		if err := recordDiaryRevision(tx, int(id), userID); err != nil {
+			log.Printf("保存日记版本失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
+		// 日记已保存，丢弃新日记的草稿
+		if _, err := tx.Exec("DELETE FROM diary_drafts WHERE user_id = ? AND diary_id = 0", userID); err != nil {
+			log.Printf("删除日记草稿失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
+		// 提交事务
+		if err := tx.Commit(); err != nil {
+			log.Printf("提交事务失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
 		log.Printf("日记创建成功，ID: %d", id)
 
+		EvaluateBadges(userID)
+
 		http.Redirect(w, r, "/diary", http.StatusSeeOther)
 	}
 }
@@ -276,12 +324,39 @@ func DeleteDiaryHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err := db.DB.Exec("DELETE FROM diaries WHERE id = ? AND user_id = ?", id, userID)
+		tx, err := db.DB.Begin()
+		if err != nil {
+			log.Printf("开始事务失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec("DELETE FROM diary_drafts WHERE diary_id = ? AND user_id = ?", id, userID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		_, err = tx.Exec("DELETE FROM diary_revisions WHERE diary_id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec("DELETE FROM diaries WHERE id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 提交事务
+		if err := tx.Commit(); err != nil {
+			log.Printf("提交事务失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
 		http.Redirect(w, r, "/diary", http.StatusSeeOther)
 	}
 }
@@ -305,7 +380,7 @@ func GetDiaryHandler(w http.ResponseWriter, r *http.Request) {
 
 	var diary models.Diary
 	err := db.DB.QueryRow(`
-		SELECT id, title, content, weather, mood, date, created_at, updated_at 
+		SELECT id, title, content, weather, mood, date, encrypted, created_at, updated_at 
 		FROM diaries 
 		WHERE id = ? AND user_id = ?
 	`, id, userID).Scan(
@@ -315,6 +390,7 @@ func GetDiaryHandler(w http.ResponseWriter, r *http.Request) {
 		&diary.Weather,
 		&diary.Mood,
 		&diary.Date,
+		&diary.Encrypted,
 		&diary.CreatedAt,
 		&diary.UpdatedAt,
 	)
@@ -332,6 +408,16 @@ func GetDiaryHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("找到日记 - 标题: %s, 内容长度: %d", diary.Title, len(diary.Content))
 
+	// 私密日记未解锁时不返回密文
+	content, readable := decryptDiaryContent(r, diary.Content, diary.Encrypted)
+	diary.Content = content
+
+	// 当天的习惯打卡备注，随日记一起展示；include_habits=0 时不附带
+	var habitNotes []models.HabitLog
+	if r.URL.Query().Get("include_habits") != "0" {
+		habitNotes = loadHabitNotesForDay(userID, diary.Date)
+	}
+
 	// Check if this is an AJAX request for editing (expects JSON)
 	ajaxHeader := r.Header.Get("X-Requested-With")
 	isJsonRequest := ajaxHeader == "XMLHttpRequest" || r.URL.Query().Get("format") == "json"
@@ -340,12 +426,17 @@ func GetDiaryHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		// Use proper JSON encoding
 		response := map[string]interface{}{
-			"id":      diary.ID,
-			"title":   diary.Title,
-			"content": diary.Content,
-			"weather": diary.Weather,
-			"mood":    diary.Mood,
-			"date":    diary.Date.Format("2006-01-02"),
+			"id":        diary.ID,
+			"title":     diary.Title,
+			"content":   diary.Content,
+			"weather":   diary.Weather,
+			"mood":      diary.Mood,
+			"date":      diary.Date.Format("2006-01-02"),
+			"encrypted": diary.Encrypted,
+			"locked":    !readable,
+		}
+		if habitNotes != nil {
+			response["habit_notes"] = habitNotes
 		}
 		encoder := json.NewEncoder(w)
 		encoder.SetEscapeHTML(false)
@@ -356,61 +447,69 @@ func GetDiaryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert newlines to <br> for HTML display
-	content := strings.ReplaceAll(diary.Content, "\n", "<br>")
+	weatherDisplay := diaryWeatherLabel(diary.Weather)
 
-	// 确保内容不为空
-	if content == "" {
-		content = "<em class='text-slate-400'>暂无内容</em>"
+	moodDisplay := diary.Mood
+	if moodDisplay == "" {
+		moodDisplay = "😊"
 	}
 
-	// Weather icons map with fallback
-	weatherIcons := map[string]string{
-		"sunny":  "☀️ 晴天",
-		"cloudy": "☁️ 多云",
-		"rainy":  "🌧️ 雨天",
-		"snowy":  "❄️ 雪天",
-		"windy":  "💨 大风",
+	data := struct {
+		Diary      models.Diary
+		Content    template.HTML
+		Weather    string
+		Mood       string
+		HabitNotes []models.HabitLog
+		Edited     bool
+		Locked     bool
+	}{
+		Diary:      diary,
+		Content:    renderMarkdown(diary.Content),
+		Weather:    weatherDisplay,
+		Mood:       moodDisplay,
+		HabitNotes: habitNotes,
+		Edited:     !diary.UpdatedAt.Equal(diary.CreatedAt),
+		Locked:     !readable,
 	}
 
-	weatherDisplay := weatherIcons[diary.Weather]
-	if weatherDisplay == "" {
-		weatherDisplay = "🌤️ 其他"
+	tmpl, err := template.ParseFiles("templates/diary_view.html")
+	if err != nil {
+		log.Printf("解析日记模板失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
 	}
 
-	moodDisplay := diary.Mood
-	if moodDisplay == "" {
-		moodDisplay = "😊"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, "diaryView", data); err != nil {
+		log.Printf("渲染日记失败: %v", err)
 	}
+}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	html := `
-		<div class="p-6">
-			<div class="mb-4">
-				<h3 class="text-xl font-bold text-slate-800 mb-2">` + diary.Title + `</h3>
-				<div class="flex items-center space-x-4 text-sm text-slate-500">
-					<span><i class="fas fa-calendar-alt mr-1"></i>` + diary.Date.Format("2006-01-02") + `</span>
-					<span>` + weatherDisplay + `</span>
-					<span class="text-2xl">` + moodDisplay + `</span>
-				</div>
-			</div>
-			<div class="prose prose-sm max-w-none">
-				<div class="text-slate-700 leading-relaxed whitespace-pre-wrap">` + content + `</div>
-			</div>
-			<div class="mt-4 text-xs text-slate-400">
-				创建时间: ` + diary.CreatedAt.Format("2006-01-02 15:04") + `
-				` + func() string {
-		if !diary.UpdatedAt.Equal(diary.CreatedAt) {
-			return `<br>更新时间: ` + diary.UpdatedAt.Format("2006-01-02 15:04")
-		}
-		return ""
-	}() + `
-			</div>
-		</div>
-	`
-
-	log.Printf("生成HTML内容长度: %d", len(html))
-	w.Write([]byte(html))
+// DiaryPreviewHandler renders the editor content as Markdown for the live preview
+func DiaryPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := GetUserIDFromContext(r); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"html": string(renderMarkdown(req.Content)),
+	})
 }
 
 func UpdateDiaryHandler(w http.ResponseWriter, r *http.Request) {
@@ -435,6 +534,7 @@ func UpdateDiaryHandler(w http.ResponseWriter, r *http.Request) {
 		weather := r.FormValue("weather")
 		mood := r.FormValue("mood")
 		dateStr := r.FormValue("date")
+		encrypted := r.FormValue("encrypted") == "1"
 
 		log.Printf("更新日记数据 - ID: %s, 标题: %s, 内容长度: %d, 天气: %s, 心情: %s, 日期: %s",
 			id, title, len(content), weather, mood, dateStr)
@@ -466,11 +566,42 @@ func UpdateDiaryHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		result, err := db.DB.Exec(`
+		diaryID, err := strconv.Atoi(id)
+		if err != nil {
+			http.Error(w, "无效的日记ID", http.StatusBadRequest)
+			return
+		}
+
+		content, err = encryptDiaryContent(r, content, encrypted)
+		if err != nil {
+			writeDiaryEncryptError(w, err)
+			return
+		}
+
+		tx, err := db.DB.Begin()
+		if err != nil {
+			log.Printf("开始事务失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// 先保存修改前的内容（旧日记还没有历史版本时尤其需要）
+		if err := recordDiaryRevision(tx, diaryID, userID); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "日记不存在", http.StatusNotFound)
+				return
+			}
+			log.Printf("保存日记版本失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
+		result, err := tx.Exec(`
 			UPDATE diaries 
-			SET title = ?, content = ?, weather = ?, mood = ?, date = ?, updated_at = ?
+			SET title = ?, content = ?, weather = ?, mood = ?, date = ?, encrypted = ?, updated_at = ?
 			WHERE id = ? AND user_id = ?
-		`, title, content, weather, mood, date, time.Now(), id, userID)
+		`, title, content, weather, mood, date, encrypted, time.Now(), diaryID, userID)
 
 		if err != nil {
 			log.Printf("数据库更新错误: %v", err)
@@ -478,9 +609,38 @@ func UpdateDiaryHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := recordDiaryRevision(tx, diaryID, userID); err != nil {
+			log.Printf("保存日记版本失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
+		// 改为私密日记时，之前的明文版本也要加密
+		if encrypted {
+			if err := encryptDiaryRevisions(tx, r, diaryID, userID); err != nil {
+				writeDiaryEncryptError(w, err)
+				return
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM diary_drafts WHERE user_id = ? AND diary_id = ?", userID, diaryID); err != nil {
+			log.Printf("删除日记草稿失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
+		// 提交事务
+		if err := tx.Commit(); err != nil {
+			log.Printf("提交事务失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+
 		rowsAffected, _ := result.RowsAffected()
 		log.Printf("日记更新成功，影响行数: %d", rowsAffected)
 
+		EvaluateBadges(userID)
+
 		http.Redirect(w, r, "/diary", http.StatusSeeOther)
 	}
 }
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxDiaryDraftTitle   = 255   // 与 diary_drafts.title 一致
+	maxDiaryDraftContent = 65535 // TEXT 的字节上限
+)
+
+// GetDiaryDraftHandler returns the autosaved draft for ?diary_id= (0 or
+// empty for a new entry); {"draft": null} when there is none
+func GetDiaryDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	diaryID := 0
+	if v := r.URL.Query().Get("diary_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			http.Error(w, "无效的日记ID", http.StatusBadRequest)
+			return
+		}
+		diaryID = id
+	}
+
+	var draft models.DiaryDraft
+	err := db.DB.QueryRow(`
+		SELECT diary_id, title, content, weather, mood, date, updated_at
+		FROM diary_drafts
+		WHERE user_id = ? AND diary_id = ?
+	`, userID, diaryID).Scan(&draft.DiaryID, &draft.Title, &draft.Content, &draft.Weather, &draft.Mood, &draft.Date, &draft.UpdatedAt)
+
+	response := map[string]interface{}{"draft": nil}
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		log.Printf("查询日记草稿失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	default:
+		response["draft"] = draft
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SaveDiaryDraftHandler stores the editor state sent periodically by the
+// diary editor, replacing the previous draft of the same entry
+func SaveDiaryDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var draft models.DiaryDraft
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := json.NewDecoder(r.Body).Decode(&draft); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if draft.DiaryID < 0 {
+		http.Error(w, "无效的日记ID", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(draft.Title) > maxDiaryDraftTitle || len(draft.Content) > maxDiaryDraftContent {
+		http.Error(w, "草稿内容过长", http.StatusBadRequest)
+		return
+	}
+	if draft.Date != "" {
+		if _, err := time.Parse("2006-01-02", draft.Date); err != nil {
+			draft.Date = ""
+		}
+	}
+	if len(draft.Weather) > 50 || len(draft.Mood) > 50 {
+		http.Error(w, "无效的天气或心情", http.StatusBadRequest)
+		return
+	}
+
+	if draft.DiaryID > 0 {
+		var encrypted bool
+		err := db.DB.QueryRow("SELECT encrypted FROM diaries WHERE id = ? AND user_id = ?", draft.DiaryID, userID).Scan(&encrypted)
+		if err == sql.ErrNoRows {
+			http.Error(w, "日记不存在", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("查询日记失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+		// 草稿是明文，私密日记不保存草稿
+		if encrypted {
+			http.Error(w, "私密日记不保存草稿", http.StatusConflict)
+			return
+		}
+	}
+
+	now := time.Now()
+	_, err := db.DB.Exec(`
+		INSERT INTO diary_drafts (user_id, diary_id, title, content, weather, mood, date, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE title = VALUES(title), content = VALUES(content), weather = VALUES(weather),
+			mood = VALUES(mood), date = VALUES(date), updated_at = VALUES(updated_at)
+	`, userID, draft.DiaryID, draft.Title, draft.Content, draft.Weather, draft.Mood, draft.Date, now)
+	if err != nil {
+		log.Printf("保存日记草稿失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"saved_at": now.Format("15:04:05"),
+	})
+}
+
+// DiscardDiaryDraftHandler deletes a draft the user chose not to keep
+func DiscardDiaryDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		DiaryID int `json:"diary_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.DB.Exec("DELETE FROM diary_drafts WHERE user_id = ? AND diary_id = ?", userID, req.DiaryID)
+	if err != nil {
+		log.Printf("删除日记草稿失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
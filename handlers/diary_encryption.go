@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+const (
+	minDiaryPassphrase = 8
+	maxEncryptedDiary  = 65535 // 密文要放进 TEXT 列
+	// diaryKeyCheckText 用设置口令时的密钥加密后保存，解锁时能解开说明口令正确
+	diaryKeyCheckText = "goblog-diary-key"
+)
+
+var (
+	errDiaryLocked  = errors.New("私密日记未解锁，请先输入口令")
+	errDiaryTooLong = errors.New("内容过长，无法加密保存")
+)
+
+// diaryEncryption is the passphrase state shown on the diary page
+type diaryEncryption struct {
+	Enabled  bool // 已设置口令
+	Unlocked bool // 本次会话已解锁
+	Error    string
+}
+
+// loadDiaryKeySettings returns the salt and check value of the user's diary
+// passphrase; both are empty when none is set
+func loadDiaryKeySettings(userID int) (salt, check string, err error) {
+	var s, c sql.NullString
+	err = db.DB.QueryRow("SELECT diary_key_salt, diary_key_check FROM users WHERE id = ?", userID).Scan(&s, &c)
+	return s.String, c.String, err
+}
+
+func loadDiaryEncryption(r *http.Request, userID int) diaryEncryption {
+	state := diaryEncryption{Error: r.URL.Query().Get("encryption_error")}
+	salt, _, err := loadDiaryKeySettings(userID)
+	if err != nil {
+		log.Printf("Error fetching diary key settings: %v", err)
+		return state
+	}
+	state.Enabled = salt != ""
+	_, state.Unlocked = auth.EncryptionKey(r)
+	return state
+}
+
+// SetupDiaryEncryptionHandler sets the passphrase for private entries and
+// unlocks them for the current session. The passphrase itself is never
+// stored; losing it makes the private entries unreadable.
+func SetupDiaryEncryptionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/diary", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	passphrase := r.FormValue("passphrase")
+	if utf8.RuneCountInString(passphrase) < minDiaryPassphrase {
+		redirectDiaryEncryptionError(w, r, "口令至少需要 8 个字符")
+		return
+	}
+	if passphrase != r.FormValue("confirm") {
+		redirectDiaryEncryptionError(w, r, "两次输入的口令不一致")
+		return
+	}
+
+	salt, err := auth.NewKeySalt()
+	if err != nil {
+		log.Printf("生成密钥盐失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	key := auth.DeriveKey(passphrase, salt)
+	check, err := auth.Encrypt(key, diaryKeyCheckText)
+	if err != nil {
+		log.Printf("生成密钥校验值失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 已经设置过口令时不覆盖，否则旧的私密日记就再也解不开了
+	result, err := db.DB.Exec(
+		"UPDATE users SET diary_key_salt = ?, diary_key_check = ? WHERE id = ? AND diary_key_salt IS NULL",
+		base64.StdEncoding.EncodeToString(salt), check, userID,
+	)
+	if err != nil {
+		log.Printf("保存私密日记口令失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		redirectDiaryEncryptionError(w, r, "已经设置过口令")
+		return
+	}
+
+	if err := auth.SetEncryptionKey(r, key); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, "/diary#private", http.StatusSeeOther)
+}
+
+// UnlockDiaryHandler checks the passphrase and keeps the derived key in
+// memory until the session ends or the user locks again
+func UnlockDiaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/diary", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	encodedSalt, check, err := loadDiaryKeySettings(userID)
+	if err != nil {
+		log.Printf("查询私密日记口令失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if encodedSalt == "" || err != nil {
+		redirectDiaryEncryptionError(w, r, "还没有设置口令")
+		return
+	}
+
+	key := auth.DeriveKey(r.FormValue("passphrase"), salt)
+	if text, err := auth.Decrypt(key, check); err != nil || text != diaryKeyCheckText {
+		redirectDiaryEncryptionError(w, r, "口令不正确")
+		return
+	}
+
+	if err := auth.SetEncryptionKey(r, key); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, "/diary#private", http.StatusSeeOther)
+}
+
+// LockDiaryHandler forgets the unlocked key
+func LockDiaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		auth.ClearEncryptionKey(r)
+	}
+	http.Redirect(w, r, "/diary#private", http.StatusSeeOther)
+}
+
+func redirectDiaryEncryptionError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/diary?encryption_error="+url.QueryEscape(message)+"#private", http.StatusSeeOther)
+}
+
+// encryptDiaryContent encrypts content with the session's key when encrypted
+// is set; errDiaryLocked means the user has to unlock first
+func encryptDiaryContent(r *http.Request, content string, encrypted bool) (string, error) {
+	if !encrypted {
+		return content, nil
+	}
+	key, ok := auth.EncryptionKey(r)
+	if !ok {
+		return "", errDiaryLocked
+	}
+	sealed, err := auth.Encrypt(key, content)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) > maxEncryptedDiary {
+		return "", errDiaryTooLong
+	}
+	return sealed, nil
+}
+
+func writeDiaryEncryptError(w http.ResponseWriter, err error) {
+	switch err {
+	case errDiaryLocked:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errDiaryTooLong:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("加密日记失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+	}
+}
+
+// decryptDiaryContent returns the readable content of an entry; ok is false
+// for encrypted entries while locked or when the key does not fit
+func decryptDiaryContent(r *http.Request, content string, encrypted bool) (string, bool) {
+	if !encrypted {
+		return content, true
+	}
+	key, unlocked := auth.EncryptionKey(r)
+	if !unlocked {
+		return "", false
+	}
+	plaintext, err := auth.Decrypt(key, content)
+	if err != nil {
+		log.Printf("解密日记失败: %v", err)
+		return "", false
+	}
+	return plaintext, true
+}
+
+// hideEncryptedContent blanks the ciphertext of private entries before they
+// are shown in lists
+func hideEncryptedContent(diaries []models.Diary) {
+	for i := range diaries {
+		if diaries[i].Encrypted {
+			diaries[i].Content = ""
+		}
+	}
+}
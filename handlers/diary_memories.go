@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	diaryDigestHour    = 8   // 每天 8 点之后发送"那年今日"
+	maxDiaryDigestBody = 500 // 与 notifications.body 一致
+)
+
+// lastDiaryDigestDay 记录调度器最近一次发送摘要的日期，避免每分钟都查询
+var lastDiaryDigestDay string
+
+// isOnThisDay reports whether date falls on today's month and day in an
+// earlier year. On Feb 28 of a non-leap year, entries from Feb 29 count too.
+func isOnThisDay(date, today time.Time) bool {
+	if date.Year() >= today.Year() {
+		return false
+	}
+	if date.Month() == today.Month() && date.Day() == today.Day() {
+		return true
+	}
+	leapDay := date.Month() == time.February && date.Day() == 29
+	lastDayOfFeb := today.Month() == time.February && today.Day() == 28 && today.AddDate(0, 0, 1).Day() == 1
+	return leapDay && lastDayOfFeb
+}
+
+// onThisDay picks the memories out of diaries that are already loaded,
+// keeping their order
+func onThisDay(diaries []models.Diary, today time.Time) []models.DiaryMemory {
+	var memories []models.DiaryMemory
+	for _, diary := range diaries {
+		if isOnThisDay(diary.Date, today) {
+			memories = append(memories, models.DiaryMemory{Diary: diary, YearsAgo: today.Year() - diary.Date.Year()})
+		}
+	}
+	return memories
+}
+
+// loadDiaryMemories returns the user's entries written on today's date in
+// earlier years, most recent year first
+func loadDiaryMemories(userID int, today time.Time) ([]models.DiaryMemory, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, title, content, weather, mood, date, encrypted, created_at, updated_at
+		FROM diaries
+		WHERE user_id = ? AND MONTH(date) = ? AND YEAR(date) < ?
+		ORDER BY date DESC, created_at DESC
+	`, userID, int(today.Month()), today.Year())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var diaries []models.Diary
+	for rows.Next() {
+		var diary models.Diary
+		if err := rows.Scan(&diary.ID, &diary.Title, &diary.Content, &diary.Weather, &diary.Mood,
+			&diary.Date, &diary.Encrypted, &diary.CreatedAt, &diary.UpdatedAt); err != nil {
+			return nil, err
+		}
+		diaries = append(diaries, diary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	hideEncryptedContent(diaries)
+	return onThisDay(diaries, today), nil
+}
+
+// diaryDigestEnabled reports whether the user opted into the daily digest
+func diaryDigestEnabled(userID int) bool {
+	var enabled bool
+	if err := db.DB.QueryRow("SELECT COALESCE(diary_digest, 0) FROM users WHERE id = ?", userID).Scan(&enabled); err != nil {
+		log.Printf("Error fetching diary digest setting: %v", err)
+		return false
+	}
+	return enabled
+}
+
+// DiaryDigestToggleHandler turns the daily "on this day" digest on or off
+// (enabled=1|0). Turning it on sends today's digest right away.
+func DiaryDigestToggleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/diary", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled := r.FormValue("enabled") == "1"
+	if _, err := db.DB.Exec("UPDATE users SET diary_digest = ? WHERE id = ?", enabled, userID); err != nil {
+		log.Printf("更新日记摘要设置失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		sendDiaryDigest(userID, time.Now())
+	}
+
+	http.Redirect(w, r, "/diary#memories", http.StatusSeeOther)
+}
+
+// checkDiaryDigests sends the daily digest to every user who opted in, once
+// a day after diaryDigestHour
+func checkDiaryDigests(now time.Time) {
+	if db.DB == nil || now.Hour() < diaryDigestHour {
+		return
+	}
+	day := now.Format("2006-01-02")
+	if lastDiaryDigestDay == day {
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT id FROM users WHERE diary_digest = 1")
+	if err != nil {
+		log.Printf("检查日记摘要失败: %v", err)
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		sendDiaryDigest(userID, now)
+	}
+	lastDiaryDigestDay = day
+}
+
+// sendDiaryDigest writes today's memories into the user's inbox; nothing is
+// sent on days without memories, and at most one digest per day
+func sendDiaryDigest(userID int, now time.Time) {
+	memories, err := loadDiaryMemories(userID, now)
+	if err != nil {
+		log.Printf("查询那年今日失败: %v", err)
+		return
+	}
+	if len(memories) == 0 {
+		return
+	}
+
+	var lines []string
+	for _, m := range memories {
+		lines = append(lines, fmt.Sprintf("%d 年前：%s", m.YearsAgo, m.Title))
+	}
+	body := strings.Join(lines, "；")
+	if runes := []rune(body); len(runes) > maxDiaryDigestBody {
+		body = string(runes[:maxDiaryDigestBody-1]) + "…"
+	}
+
+	link := "/diary#memories"
+	if len(memories) == 1 {
+		link = fmt.Sprintf("/diary?view=%d", memories[0].ID)
+	}
+	title := fmt.Sprintf("那年今日：%d 篇回忆", len(memories))
+	createNotification(userID, "diary_digest", title, body, link, "diary_digest:"+now.Format("2006-01-02"))
+}
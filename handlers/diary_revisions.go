@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"database/sql"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDiffCells bounds the LCS table; larger inputs are shown as a full
+// replacement instead of a line diff
+const maxDiffCells = 4000000
+
+// DiaryRevisionsHandler lists the saved versions of a diary entry and shows
+// the diff between two of them (?from=&to= revision IDs, default the two latest)
+func DiaryRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, _ := auth.ValidateSession(r)
+
+	diaryID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "无效的日记ID", http.StatusBadRequest)
+		return
+	}
+
+	var diary models.Diary
+	err = db.DB.QueryRow(`
+		SELECT id, title, content, weather, mood, date, created_at, updated_at
+		FROM diaries
+		WHERE id = ? AND user_id = ?
+	`, diaryID, userID).Scan(&diary.ID, &diary.Title, &diary.Content, &diary.Weather, &diary.Mood, &diary.Date, &diary.CreatedAt, &diary.UpdatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "日记不存在", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("查询日记失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := loadDiaryRevisions(diaryID, userID)
+	if err != nil {
+		log.Printf("查询日记历史版本失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 私密版本解锁后才能对比内容
+	locked := false
+	for i := range revisions {
+		content, readable := decryptDiaryContent(r, revisions[i].Content, revisions[i].Encrypted)
+		revisions[i].Content = content
+		if !readable {
+			locked = true
+		}
+	}
+
+	// 默认对比最新的两个版本
+	var from, to *models.DiaryRevision
+	if len(revisions) > 0 {
+		to = &revisions[0]
+		from = to
+		if len(revisions) > 1 {
+			from = &revisions[1]
+		}
+	}
+	if rev := findDiaryRevision(revisions, r.URL.Query().Get("from")); rev != nil {
+		from = rev
+	}
+	if rev := findDiaryRevision(revisions, r.URL.Query().Get("to")); rev != nil {
+		to = rev
+	}
+
+	var diff []models.DiffLine
+	added, removed := 0, 0
+	if from != nil && to != nil && !locked {
+		diff = diffLines(from.Content, to.Content)
+		for _, line := range diff {
+			switch line.Kind {
+			case "add":
+				added++
+			case "del":
+				removed++
+			}
+		}
+	}
+
+	data := struct {
+		Diary      models.Diary
+		Revisions  []models.DiaryRevision
+		From       *models.DiaryRevision
+		To         *models.DiaryRevision
+		Diff       []models.DiffLine
+		Added      int
+		Removed    int
+		Locked     bool
+		Weathers   []diaryOption
+		ActivePage string
+		User       *auth.Session
+		IsLoggedIn bool
+	}{
+		Diary:      diary,
+		Revisions:  revisions,
+		From:       from,
+		To:         to,
+		Diff:       diff,
+		Added:      added,
+		Removed:    removed,
+		Locked:     locked,
+		Weathers:   diaryWeatherOptions,
+		ActivePage: "diary",
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	renderTemplate(w, "diary_revisions.html", data)
+}
+
+// RestoreDiaryRevisionHandler writes an older version back to the diary. The
+// restore is itself saved as a new revision, so it can be undone.
+func RestoreDiaryRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/diary", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	revisionID, err := strconv.Atoi(r.FormValue("revision_id"))
+	if err != nil {
+		http.Error(w, "无效的版本ID", http.StatusBadRequest)
+		return
+	}
+
+	var rev models.DiaryRevision
+	err = db.DB.QueryRow(`
+		SELECT id, diary_id, title, content, weather, mood, date, encrypted
+		FROM diary_revisions
+		WHERE id = ? AND user_id = ?
+	`, revisionID, userID).Scan(&rev.ID, &rev.DiaryID, &rev.Title, &rev.Content, &rev.Weather, &rev.Mood, &rev.Date, &rev.Encrypted)
+	if err == sql.ErrNoRows {
+		http.Error(w, "版本不存在", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("查询日记版本失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("开始事务失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// 恢复前先保存当前内容，防止没有记录过的修改丢失
+	if err := recordDiaryRevision(tx, rev.DiaryID, userID); err != nil {
+		log.Printf("保存日记版本失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE diaries
+		SET title = ?, content = ?, weather = ?, mood = ?, date = ?, encrypted = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`, rev.Title, rev.Content, rev.Weather, rev.Mood, rev.Date, rev.Encrypted, time.Now(), rev.DiaryID, userID)
+	if err != nil {
+		log.Printf("恢复日记版本失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordDiaryRevision(tx, rev.DiaryID, userID); err != nil {
+		log.Printf("保存日记版本失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		log.Printf("提交事务失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("日记 %d 已恢复到版本 %d", rev.DiaryID, rev.ID)
+	EvaluateBadges(userID)
+
+	http.Redirect(w, r, "/diary/revisions?id="+strconv.Itoa(rev.DiaryID), http.StatusSeeOther)
+}
+
+// recordDiaryRevision saves the diary's current state as a revision unless it
+// is identical to the latest one. It is called before an update too, so
+// entries written before revisions existed keep their original version.
+func recordDiaryRevision(tx *sql.Tx, diaryID, userID int) error {
+	var d models.Diary
+	err := tx.QueryRow(`
+		SELECT title, content, weather, mood, date, encrypted, updated_at
+		FROM diaries
+		WHERE id = ? AND user_id = ?
+	`, diaryID, userID).Scan(&d.Title, &d.Content, &d.Weather, &d.Mood, &d.Date, &d.Encrypted, &d.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	var latest models.DiaryRevision
+	err = tx.QueryRow(`
+		SELECT title, content, weather, mood, date, encrypted
+		FROM diary_revisions
+		WHERE diary_id = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, diaryID).Scan(&latest.Title, &latest.Content, &latest.Weather, &latest.Mood, &latest.Date, &latest.Encrypted)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case latest.Title == d.Title && latest.Content == d.Content && latest.Weather == d.Weather &&
+		latest.Mood == d.Mood && latest.Date.Equal(d.Date) && latest.Encrypted == d.Encrypted:
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO diary_revisions (diary_id, user_id, title, content, weather, mood, date, encrypted, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, diaryID, userID, d.Title, d.Content, d.Weather, d.Mood, d.Date, d.Encrypted, d.UpdatedAt)
+	return err
+}
+
+// encryptDiaryRevisions encrypts the plaintext revisions of a diary that
+// has just been made private, so no readable copy is left behind
+func encryptDiaryRevisions(tx *sql.Tx, r *http.Request, diaryID, userID int) error {
+	rows, err := tx.Query(
+		"SELECT id, content FROM diary_revisions WHERE diary_id = ? AND user_id = ? AND encrypted = 0",
+		diaryID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	var revisions []models.DiaryRevision
+	for rows.Next() {
+		var rev models.DiaryRevision
+		if err := rows.Scan(&rev.ID, &rev.Content); err != nil {
+			rows.Close()
+			return err
+		}
+		revisions = append(revisions, rev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rev := range revisions {
+		content, err := encryptDiaryContent(r, rev.Content, true)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE diary_revisions SET content = ?, encrypted = 1 WHERE id = ?", content, rev.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadDiaryRevisions(diaryID, userID int) ([]models.DiaryRevision, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, diary_id, title, content, weather, mood, date, encrypted, created_at
+		FROM diary_revisions
+		WHERE diary_id = ? AND user_id = ?
+		ORDER BY id DESC
+	`, diaryID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.DiaryRevision
+	for rows.Next() {
+		var rev models.DiaryRevision
+		if err := rows.Scan(&rev.ID, &rev.DiaryID, &rev.Title, &rev.Content, &rev.Weather, &rev.Mood, &rev.Date, &rev.Encrypted, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func findDiaryRevision(revisions []models.DiaryRevision, idStr string) *models.DiaryRevision {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil
+	}
+	for i := range revisions {
+		if revisions[i].ID == id {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
+
+// diffLines computes a line diff from a to b using the longest common
+// subsequence of lines
+func diffLines(a, b string) []models.DiffLine {
+	oldLines := splitDiffLines(a)
+	newLines := splitDiffLines(b)
+
+	// 去掉相同的开头和结尾，缩小 LCS 表
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var diff []models.DiffLine
+	for _, line := range oldLines[:prefix] {
+		diff = append(diff, models.DiffLine{Kind: "same", Text: line})
+	}
+
+	x := oldLines[prefix : len(oldLines)-suffix]
+	y := newLines[prefix : len(newLines)-suffix]
+	if len(x)*len(y) > maxDiffCells {
+		for _, line := range x {
+			diff = append(diff, models.DiffLine{Kind: "del", Text: line})
+		}
+		for _, line := range y {
+			diff = append(diff, models.DiffLine{Kind: "add", Text: line})
+		}
+	} else {
+		// lcs[i][j] 是 x[i:] 与 y[j:] 的最长公共子序列长度
+		lcs := make([][]int, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				diff = append(diff, models.DiffLine{Kind: "same", Text: x[i]})
+				i++
+				j++
+			case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+				diff = append(diff, models.DiffLine{Kind: "add", Text: y[j]})
+				j++
+			default:
+				diff = append(diff, models.DiffLine{Kind: "del", Text: x[i]})
+				i++
+			}
+		}
+	}
+
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		diff = append(diff, models.DiffLine{Kind: "same", Text: line})
+	}
+	return diff
+}
+
+func splitDiffLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"database/sql"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxDiarySearchTerms   = 10
+	maxDiarySearchResults = 100
+	diarySnippetRunes     = 120 // 摘要长度
+	diarySnippetLead      = 30  // 命中位置前保留的字数
+	ngramTokenSize        = 2   // MySQL ngram_token_size 默认值，更短的词无法走全文索引
+)
+
+// diaryOption is a value/label pair for the mood and weather filters
+type diaryOption struct {
+	Value string
+	Label string
+}
+
+var diaryWeatherOptions = []diaryOption{
+	{"sunny", "☀️ 晴天"},
+	{"cloudy", "☁️ 多云"},
+	{"rainy", "🌧️ 雨天"},
+	{"snowy", "❄️ 雪天"},
+	{"windy", "💨 大风"},
+}
+
+// diaryWeatherLabel returns the display label for a weather value
+func diaryWeatherLabel(value string) string {
+	for _, opt := range diaryWeatherOptions {
+		if opt.Value == value {
+			return opt.Label
+		}
+	}
+	return "🌤️ 其他"
+}
+
+var diaryMoodOptions = []string{"😊", "😔", "😡", "😎", "🥰", "😴", "🤔", "😤"}
+
+// diarySearchFilter holds the parsed query string of /diary/search
+type diarySearchFilter struct {
+	Query   string
+	Terms   []string
+	Mood    string
+	Weather string
+	From    string
+	To      string
+}
+
+// DiarySearchHandler searches diary titles and content with optional mood,
+// weather and date filters
+func DiarySearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, _ := auth.ValidateSession(r)
+
+	filter := parseDiarySearchFilter(r)
+	searched := filter.Query != "" || filter.Mood != "" || filter.Weather != "" || filter.From != "" || filter.To != ""
+
+	var results []models.DiarySearchResult
+	if searched {
+		var err error
+		results, err = searchDiaries(userID, filter)
+		if err != nil {
+			log.Printf("搜索日记失败: %v", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := struct {
+		Filter     diarySearchFilter
+		Searched   bool
+		Results    []models.DiarySearchResult
+		Limit      int
+		Moods      []string
+		Weathers   []diaryOption
+		ActivePage string
+		User       *auth.Session
+		IsLoggedIn bool
+	}{
+		Filter:     filter,
+		Searched:   searched,
+		Results:    results,
+		Limit:      maxDiarySearchResults,
+		Moods:      diaryMoodOptions,
+		Weathers:   diaryWeatherOptions,
+		ActivePage: "diary",
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	renderTemplate(w, "diary_search.html", data)
+}
+
+func parseDiarySearchFilter(r *http.Request) diarySearchFilter {
+	q := r.URL.Query()
+	filter := diarySearchFilter{
+		Query:   strings.TrimSpace(q.Get("q")),
+		Mood:    q.Get("mood"),
+		Weather: q.Get("weather"),
+	}
+	filter.Terms = diarySearchTerms(filter.Query)
+
+	// 日期格式不对时忽略该条件
+	if _, err := time.Parse("2006-01-02", q.Get("from")); err == nil {
+		filter.From = q.Get("from")
+	}
+	if _, err := time.Parse("2006-01-02", q.Get("to")); err == nil {
+		filter.To = q.Get("to")
+	}
+	return filter
+}
+
+// diarySearchTerms splits the query on whitespace and drops the characters
+// that are operators in MySQL boolean full-text mode
+func diarySearchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		term := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`"+-<>()~*@'\`, r) {
+				return -1
+			}
+			return r
+		}, field)
+		if term == "" || containsString(terms, term) {
+			continue
+		}
+		terms = append(terms, term)
+		if len(terms) == maxDiarySearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// searchDiaries runs the search using the FULLTEXT index, falling back to
+// LIKE when the index is unavailable (e.g. a MySQL without the ngram parser)
+func searchDiaries(userID int, filter diarySearchFilter) ([]models.DiarySearchResult, error) {
+	rows, err := queryDiarySearch(userID, filter, true)
+	if err != nil {
+		log.Printf("全文检索失败，改用 LIKE 查询: %v", err)
+		rows, err = queryDiarySearch(userID, filter, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.DiarySearchResult
+	for rows.Next() {
+		var d models.Diary
+		var score float64
+		if err := rows.Scan(&d.ID, &d.Title, &d.Content, &d.Weather, &d.Mood, &d.Date, &d.Encrypted, &d.CreatedAt, &d.UpdatedAt, &score); err != nil {
+			return nil, err
+		}
+		if d.Encrypted {
+			// 私密日记的内容是密文，只按标题匹配
+			if len(filter.Terms) > 0 && firstMatch([]rune(d.Title), filter.Terms) < 0 {
+				continue
+			}
+			results = append(results, models.DiarySearchResult{
+				Diary: d,
+				Title: highlightSegments(d.Title, filter.Terms),
+			})
+			continue
+		}
+		results = append(results, models.DiarySearchResult{
+			Diary:   d,
+			Title:   highlightSegments(d.Title, filter.Terms),
+			Snippet: diarySnippet(markdownExcerpt(d.Content), filter.Terms),
+		})
+	}
+	return results, rows.Err()
+}
+
+func queryDiarySearch(userID int, filter diarySearchFilter, fullText bool) (*sql.Rows, error) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	score := "0"
+	var scoreArgs []interface{}
+
+	var likeTerms []string
+	var against []string
+	for _, term := range filter.Terms {
+		if fullText && utf8.RuneCountInString(term) >= ngramTokenSize {
+			// 短语匹配：ngram 分词后要求各字连续出现
+			against = append(against, `+"`+term+`"`)
+		} else {
+			likeTerms = append(likeTerms, term)
+		}
+	}
+	if len(against) > 0 {
+		score = "MATCH(title, content) AGAINST(? IN BOOLEAN MODE)"
+		scoreArgs = append(scoreArgs, strings.Join(against, " "))
+		where = append(where, "MATCH(title, content) AGAINST(? IN BOOLEAN MODE)")
+		args = append(args, strings.Join(against, " "))
+	}
+	for _, term := range likeTerms {
+		pattern := "%" + escapeLike(term) + "%"
+		where = append(where, "(title LIKE ? OR content LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+
+	if filter.Mood != "" {
+		where = append(where, "mood = ?")
+		args = append(args, filter.Mood)
+	}
+	if filter.Weather != "" {
+		where = append(where, "weather = ?")
+		args = append(args, filter.Weather)
+	}
+	if filter.From != "" {
+		where = append(where, "date >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		where = append(where, "date < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, filter.To)
+	}
+
+	query := `
+		SELECT id, title, content, weather, mood, date, encrypted, created_at, updated_at, ` + score + ` AS score
+		FROM diaries
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY score DESC, date DESC, id DESC
+		LIMIT ?`
+	args = append(append(scoreArgs, args...), maxDiarySearchResults)
+	return db.DB.Query(query, args...)
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied term
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// diarySnippet cuts a window of the text around the first match
+func diarySnippet(text string, terms []string) []models.HighlightSegment {
+	runes := []rune(text)
+	start := 0
+	if pos := firstMatch(runes, terms); pos > diarySnippetLead {
+		start = pos - diarySnippetLead
+	}
+	end := start + diarySnippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return highlightSegments(snippet, terms)
+}
+
+// firstMatch returns the rune offset of the earliest term match, or -1
+func firstMatch(runes []rune, terms []string) int {
+	for i := range runes {
+		if matchTermAt(runes, i, terms) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchTermAt returns the length in runes of the longest term matching at
+// runes[i], case-insensitively
+func matchTermAt(runes []rune, i int, terms []string) int {
+	longest := 0
+	for _, term := range terms {
+		n := 0
+		matched := true
+		for _, tr := range term {
+			if i+n >= len(runes) || unicode.ToLower(runes[i+n]) != unicode.ToLower(tr) {
+				matched = false
+				break
+			}
+			n++
+		}
+		if matched && n > longest {
+			longest = n
+		}
+	}
+	return longest
+}
+
+// highlightSegments splits text into matching and non-matching parts
+func highlightSegments(text string, terms []string) []models.HighlightSegment {
+	runes := []rune(text)
+	var segments []models.HighlightSegment
+	plainStart := 0
+	for i := 0; i < len(runes); {
+		n := matchTermAt(runes, i, terms)
+		if n == 0 {
+			i++
+			continue
+		}
+		if i > plainStart {
+			segments = append(segments, models.HighlightSegment{Text: string(runes[plainStart:i])})
+		}
+		segments = append(segments, models.HighlightSegment{Text: string(runes[i : i+n]), Match: true})
+		i += n
+		plainStart = i
+	}
+	if plainStart < len(runes) {
+		segments = append(segments, models.HighlightSegment{Text: string(runes[plainStart:])})
+	}
+	return segments
+}
@@ -96,6 +96,8 @@ func AddTransactionHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	EvaluateBadges(userID)
+
 	http.Redirect(w, r, "/finance", http.StatusSeeOther)
 }
 
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxHabitNoteLength  = 500  // 打卡备注最大字符数
+	maxHabitLogDuration = 1440 // 单次打卡时长上限（分钟）
+)
+
+// UpdateHabitLogHandler edits the note, mood and duration of a check-in
+func UpdateHabitLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	note, mood, duration := parseHabitLogForm(r)
+
+	_, err := db.DB.Exec(`
+		UPDATE habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id
+		SET hl.note = ?, hl.mood = ?, hl.duration_minutes = ?
+		WHERE hl.id = ? AND h.user_id = ?
+	`, note, mood, duration, id, userID)
+	if err != nil {
+		log.Println("Error updating habit log:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// parseHabitLogForm reads the optional note, mood and duration of a check-in
+func parseHabitLogForm(r *http.Request) (note, mood string, duration int) {
+	note = strings.TrimSpace(r.FormValue("note"))
+	if runes := []rune(note); len(runes) > maxHabitNoteLength {
+		note = string(runes[:maxHabitNoteLength])
+	}
+
+	mood = strings.TrimSpace(r.FormValue("mood"))
+	if len(mood) > 16 {
+		mood = ""
+	}
+
+	duration, _ = strconv.Atoi(r.FormValue("duration"))
+	if duration < 0 {
+		duration = 0
+	}
+	if duration > maxHabitLogDuration {
+		duration = maxHabitLogDuration
+	}
+	return note, mood, duration
+}
+
+// loadHabitLogs loads the check-ins of a habit in [from, to)
+func loadHabitLogs(habitID int, from, to time.Time) []models.HabitLog {
+	rows, err := db.DB.Query(`
+		SELECT id, habit_id, date, COALESCE(note, ''), COALESCE(mood, ''), COALESCE(duration_minutes, 0)
+		FROM habit_logs
+		WHERE habit_id = ? AND date >= ? AND date < ?
+		ORDER BY date
+	`, habitID, from, to)
+	if err != nil {
+		log.Printf("Error fetching habit logs: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var logs []models.HabitLog
+	for rows.Next() {
+		var l models.HabitLog
+		if err := rows.Scan(&l.ID, &l.HabitID, &l.Date, &l.Note, &l.Mood, &l.Duration); err != nil {
+			log.Printf("Error scanning habit log: %v", err)
+			continue
+		}
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+// loadHabitNotesForDay returns the user's check-ins of one day that carry a note, mood or duration
+func loadHabitNotesForDay(userID int, day time.Time) []models.HabitLog {
+	startOfDay := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+
+	rows, err := db.DB.Query(`
+		SELECT hl.id, hl.habit_id, h.name, hl.date, COALESCE(hl.note, ''), COALESCE(hl.mood, ''), COALESCE(hl.duration_minutes, 0)
+		FROM habit_logs hl
+		INNER JOIN habits h ON hl.habit_id = h.id
+		WHERE h.user_id = ? AND hl.date >= ? AND hl.date < ?
+		AND (hl.note <> '' OR hl.mood <> '' OR hl.duration_minutes > 0)
+		ORDER BY hl.date
+	`, userID, startOfDay, startOfDay.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("Error fetching habit notes: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var logs []models.HabitLog
+	for rows.Next() {
+		var l models.HabitLog
+		if err := rows.Scan(&l.ID, &l.HabitID, &l.HabitName, &l.Date, &l.Note, &l.Mood, &l.Duration); err != nil {
+			log.Printf("Error scanning habit note: %v", err)
+			continue
+		}
+		logs = append(logs, l)
+	}
+	return logs
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPauseLookback 计算连续天数时最多向前跳过的暂停天数
+const maxPauseLookback = 366
+
+// PauseHabitHandler pauses a habit for a date range or excuses a single day
+func PauseHabitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	habitID, _ := strconv.Atoi(r.FormValue("habit_id"))
+	kind := r.FormValue("kind")
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	startStr := r.FormValue("start_date")
+	endStr := r.FormValue("end_date")
+
+	if kind != "skip" {
+		kind = "pause"
+	}
+	// 请假只针对单日
+	if kind == "skip" || endStr == "" {
+		endStr = startStr
+	}
+
+	startDate, err := time.ParseInLocation("2006-01-02", startStr, time.Local)
+	if err != nil {
+		http.Error(w, "开始日期格式错误", http.StatusBadRequest)
+		return
+	}
+	endDate, err := time.ParseInLocation("2006-01-02", endStr, time.Local)
+	if err != nil {
+		http.Error(w, "结束日期格式错误", http.StatusBadRequest)
+		return
+	}
+	if endDate.Before(startDate) {
+		http.Error(w, "结束日期不能早于开始日期", http.StatusBadRequest)
+		return
+	}
+
+	// Verify habit belongs to user
+	var count int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
+	if err != nil || count == 0 {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	_, err = db.DB.Exec("INSERT INTO habit_pauses (habit_id, kind, start_date, end_date, reason) VALUES (?, ?, ?, ?, ?)",
+		habitID, kind, startDate, endDate, reason)
+	if err != nil {
+		log.Println("Error pausing habit:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// DeleteHabitPauseHandler removes a pause or excused day
+func DeleteHabitPauseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	_, err := db.DB.Exec("DELETE hp FROM habit_pauses hp INNER JOIN habits h ON hp.habit_id = h.id WHERE hp.id = ? AND h.user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error deleting habit pause:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// HabitHistoryHandler returns check-ins and excused days of a habit for one month as JSON
+func HabitHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	habitID, _ := strconv.Atoi(r.URL.Query().Get("habit_id"))
+
+	// Verify habit belongs to user
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ?", habitID, userID).Scan(&count)
+	if err != nil || count == 0 {
+		http.Error(w, "习惯不存在", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	if month := r.URL.Query().Get("month"); month != "" {
+		parsed, err := time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			http.Error(w, "月份格式错误", http.StatusBadRequest)
+			return
+		}
+		startOfMonth = parsed
+	}
+	endOfMonth := startOfMonth.AddDate(0, 1, 0)
+
+	checked := []string{}
+	rows, err := db.DB.Query("SELECT DISTINCT DATE(date) FROM habit_logs WHERE habit_id = ? AND date >= ? AND date < ? ORDER BY DATE(date)", habitID, startOfMonth, endOfMonth)
+	if err != nil {
+		log.Printf("Error fetching habit history: %v", err)
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var day time.Time
+			if err := rows.Scan(&day); err == nil {
+				checked = append(checked, day.Format("2006-01-02"))
+			}
+		}
+	}
+
+	// 带备注、心情或时长的打卡记录
+	notes := []models.HabitLog{}
+	for _, l := range loadHabitLogs(habitID, startOfMonth, endOfMonth) {
+		if l.Note != "" || l.Mood != "" || l.Duration > 0 {
+			notes = append(notes, l)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"month":   startOfMonth.Format("2006-01"),
+		"checked": checked,
+		"excused": excusedDays(loadHabitPauses(habitID, startOfMonth, endOfMonth), startOfMonth, endOfMonth),
+		"notes":   notes,
+	})
+}
+
+// loadHabitPauses loads the pauses of a habit overlapping [from, to).
+// A zero to means no upper bound.
+func loadHabitPauses(habitID int, from, to time.Time) []models.HabitPause {
+	query := "SELECT id, habit_id, kind, start_date, end_date, reason, created_at FROM habit_pauses WHERE habit_id = ? AND end_date >= ?"
+	args := []interface{}{habitID, from.Format("2006-01-02")}
+	if !to.IsZero() {
+		query += " AND start_date < ?"
+		args = append(args, to.Format("2006-01-02"))
+	}
+	query += " ORDER BY start_date"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error fetching habit pauses: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var pauses []models.HabitPause
+	for rows.Next() {
+		var p models.HabitPause
+		if err := rows.Scan(&p.ID, &p.HabitID, &p.Kind, &p.StartDate, &p.EndDate, &p.Reason, &p.CreatedAt); err != nil {
+			log.Printf("Error scanning habit pause: %v", err)
+			continue
+		}
+		pauses = append(pauses, p)
+	}
+	return pauses
+}
+
+// excusedDays expands pauses into a "2006-01-02" -> kind map, limited to [from, to)
+func excusedDays(pauses []models.HabitPause, from, to time.Time) map[string]string {
+	days := make(map[string]string)
+	for _, p := range pauses {
+		day := time.Date(p.StartDate.Year(), p.StartDate.Month(), p.StartDate.Day(), 0, 0, 0, 0, time.Local)
+		end := time.Date(p.EndDate.Year(), p.EndDate.Month(), p.EndDate.Day(), 0, 0, 0, 0, time.Local)
+		if day.Before(from) {
+			day = from
+		}
+		for ; !day.After(end) && day.Before(to); day = day.AddDate(0, 0, 1) {
+			days[day.Format("2006-01-02")] = p.Kind
+		}
+	}
+	return days
+}
+
+// previousDueDay returns the last day before startOfDay that was not paused or excused
+func previousDueDay(habitID int, startOfDay time.Time) time.Time {
+	from := startOfDay.AddDate(0, 0, -maxPauseLookback)
+	excused := excusedDays(loadHabitPauses(habitID, from, startOfDay), from, startOfDay)
+
+	day := startOfDay.AddDate(0, 0, -1)
+	for day.After(from) && excused[day.Format("2006-01-02")] != "" {
+		day = day.AddDate(0, 0, -1)
+	}
+	return day
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// habitRoutineKinds lists the supported routine kinds
+var habitRoutineKinds = map[string]bool{"morning": true, "evening": true, "custom": true}
+
+// AddHabitRoutineHandler creates a new habit routine (group)
+func AddHabitRoutineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name, kind, reminder, ok := parseHabitRoutineForm(r)
+	if !ok {
+		log.Println("Error adding habit routine: invalid input")
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// 新分组排在最后
+	var maxOrder sql.NullInt64
+	db.DB.QueryRow("SELECT MAX(sort_order) FROM habit_routines WHERE user_id = ?", userID).Scan(&maxOrder)
+
+	_, err := db.DB.Exec("INSERT INTO habit_routines (user_id, name, kind, reminder_time, sort_order) VALUES (?, ?, ?, ?, ?)",
+		userID, name, kind, reminder, maxOrder.Int64+1)
+	if err != nil {
+		log.Println("Error adding habit routine:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// UpdateHabitRoutineHandler renames a routine or changes its kind and reminder time
+func UpdateHabitRoutineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	name, kind, reminder, ok := parseHabitRoutineForm(r)
+	if !ok {
+		log.Println("Error updating habit routine: invalid input")
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	_, err := db.DB.Exec("UPDATE habit_routines SET name = ?, kind = ?, reminder_time = ? WHERE id = ? AND user_id = ?",
+		name, kind, reminder, id, userID)
+	if err != nil {
+		log.Println("Error updating habit routine:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// DeleteHabitRoutineHandler deletes a routine; its habits become ungrouped
+func DeleteHabitRoutineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	_, err := db.DB.Exec("UPDATE habits SET routine_id = NULL WHERE routine_id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error ungrouping habits:", err)
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	_, err = db.DB.Exec("DELETE FROM habit_routines WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error deleting habit routine:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// ReorderHabitsHandler moves habits into a routine and stores their order.
+// Body: {"routine_id": 3, "habit_ids": [5, 2, 9]}; routine_id 0 means ungrouped.
+func ReorderHabitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		RoutineID int   `json:"routine_id"`
+		HabitIDs  []int `json:"habit_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var routineID interface{}
+	if request.RoutineID > 0 {
+		// Verify routine belongs to user
+		var count int
+		err := db.DB.QueryRow("SELECT COUNT(*) FROM habit_routines WHERE id = ? AND user_id = ?", request.RoutineID, userID).Scan(&count)
+		if err != nil || count == 0 {
+			http.Error(w, "分组不存在", http.StatusNotFound)
+			return
+		}
+		routineID = request.RoutineID
+	}
+
+	// Update routine and sort order for each habit; user_id guards against foreign IDs
+	for i, id := range request.HabitIDs {
+		_, err := db.DB.Exec("UPDATE habits SET routine_id = ?, sort_order = ? WHERE id = ? AND user_id = ?", routineID, i+1, id, userID)
+		if err != nil {
+			http.Error(w, "Error updating habit order", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Habits reordered successfully"})
+}
+
+// parseHabitRoutineForm reads and validates the routine form fields
+func parseHabitRoutineForm(r *http.Request) (name, kind, reminder string, ok bool) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	kind = r.FormValue("kind")
+	reminder = strings.TrimSpace(r.FormValue("reminder_time"))
+
+	if name == "" {
+		return "", "", "", false
+	}
+	if !habitRoutineKinds[kind] {
+		kind = "custom"
+	}
+	if reminder != "" {
+		if _, err := time.Parse("15:04", reminder); err != nil {
+			return "", "", "", false
+		}
+	}
+	return name, kind, reminder, true
+}
+
+// loadHabitRoutines loads the user's routines in display order
+func loadHabitRoutines(userID int) []models.HabitRoutine {
+	rows, err := db.DB.Query("SELECT id, name, kind, COALESCE(reminder_time, ''), sort_order FROM habit_routines WHERE user_id = ? ORDER BY sort_order, id", userID)
+	if err != nil {
+		log.Printf("Error fetching habit routines: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var routines []models.HabitRoutine
+	for rows.Next() {
+		var rt models.HabitRoutine
+		if err := rows.Scan(&rt.ID, &rt.Name, &rt.Kind, &rt.ReminderTime, &rt.SortOrder); err != nil {
+			log.Printf("Error scanning habit routine: %v", err)
+			continue
+		}
+		routines = append(routines, rt)
+	}
+	return routines
+}
+
+// groupHabitsByRoutine places habits into their routines. Habits without a
+// routine (or with a deleted one) go into a trailing "未分组" group with ID 0.
+func groupHabitsByRoutine(routines []models.HabitRoutine, habits []models.Habit, now time.Time) []models.HabitRoutine {
+	index := make(map[int]int, len(routines))
+	for i, rt := range routines {
+		index[rt.ID] = i
+	}
+
+	ungrouped := models.HabitRoutine{Name: "未分组", Kind: "custom"}
+	for _, h := range habits {
+		if i, exists := index[h.RoutineID]; exists {
+			routines[i].Habits = append(routines[i].Habits, h)
+		} else {
+			ungrouped.Habits = append(ungrouped.Habits, h)
+		}
+	}
+	routines = append(routines, ungrouped)
+
+	// 到了提醒时间但还有未打卡的习惯，标记为待完成
+	clock := now.Format("15:04")
+	for i := range routines {
+		pending := 0
+		for _, h := range routines[i].Habits {
+			if h.TodayChecked {
+				routines[i].Done++
+			} else if !h.PausedToday {
+				pending++
+			}
+		}
+		routines[i].Due = routines[i].ReminderTime != "" && clock >= routines[i].ReminderTime && pending > 0
+	}
+	return routines
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// habitTemplateCategories lists template categories in display order
+var habitTemplateCategories = []struct {
+	Key  string
+	Name string
+}{
+	{"exercise", "运动"},
+	{"reading", "阅读"},
+	{"sleep", "睡眠"},
+	{"hydration", "饮水"},
+	{"other", "其他"},
+}
+
+// habitTemplateGroup is a category of templates shown in the catalog
+type habitTemplateGroup struct {
+	Key       string
+	Name      string
+	Templates []models.HabitTemplate
+}
+
+// AdoptHabitTemplateHandler creates a habit from a catalog template in one click
+func AdoptHabitTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	templateID, _ := strconv.Atoi(r.FormValue("template_id"))
+
+	var t models.HabitTemplate
+	err := db.DB.QueryRow(`
+		SELECT id, name, description, frequency, target_value, target_unit, routine_kind
+		FROM habit_templates
+		WHERE id = ? AND is_active = 1
+	`, templateID).Scan(&t.ID, &t.Name, &t.Description, &t.Frequency, &t.TargetValue, &t.TargetUnit, &t.RoutineKind)
+	if err != nil {
+		log.Println("Error loading habit template:", err)
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// 如果用户有对应类型的分组（晨间/晚间），直接放进去
+	var routine interface{}
+	if t.RoutineKind != "" {
+		var routineID int
+		err := db.DB.QueryRow("SELECT id FROM habit_routines WHERE user_id = ? AND kind = ? ORDER BY sort_order, id LIMIT 1", userID, t.RoutineKind).Scan(&routineID)
+		if err == nil {
+			routine = routineID
+		}
+	}
+
+	var maxOrder sql.NullInt64
+	db.DB.QueryRow("SELECT MAX(sort_order) FROM habits WHERE user_id = ?", userID).Scan(&maxOrder)
+
+	_, err = db.DB.Exec("INSERT INTO habits (user_id, name, description, frequency, routine_id, sort_order, target_value, target_unit) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, t.Name, t.Description, t.Frequency, routine, maxOrder.Int64+1, t.TargetValue, t.TargetUnit)
+	if err != nil {
+		log.Println("Error adopting habit template:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// AdminHabitTemplatesHandler 习惯模板库管理页面
+func AdminHabitTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"Templates":  loadHabitTemplates(false),
+		"Categories": habitTemplateCategories,
+	}
+
+	renderAdminTemplate(w, "admin/templates.html", data)
+}
+
+// AdminAddHabitTemplateHandler 添加习惯模板
+func AdminAddHabitTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "模板名称不能为空", http.StatusBadRequest)
+		return
+	}
+
+	category := r.FormValue("category")
+	if habitTemplateCategoryName(category) == "" {
+		category = "other"
+	}
+	frequency := r.FormValue("frequency")
+	if frequency != "weekly" {
+		frequency = "daily"
+	}
+	routineKind := r.FormValue("routine_kind")
+	if routineKind != "morning" && routineKind != "evening" {
+		routineKind = ""
+	}
+	targetValue, _ := strconv.Atoi(r.FormValue("target_value"))
+	if targetValue < 0 {
+		targetValue = 0
+	}
+
+	var maxOrder sql.NullInt64
+	db.DB.QueryRow("SELECT MAX(sort_order) FROM habit_templates").Scan(&maxOrder)
+
+	_, err := db.DB.Exec(
+		"INSERT INTO habit_templates (name, description, category, icon, frequency, target_value, target_unit, routine_kind, sort_order) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		name, strings.TrimSpace(r.FormValue("description")), category, strings.TrimSpace(r.FormValue("icon")),
+		frequency, targetValue, strings.TrimSpace(r.FormValue("target_unit")), routineKind, maxOrder.Int64+1,
+	)
+	if err != nil {
+		log.Printf("添加习惯模板失败: %v", err)
+		http.Error(w, "添加习惯模板失败", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+}
+
+// AdminToggleHabitTemplateHandler 启用或停用习惯模板；停用后用户看不到，已采用的习惯不受影响
+func AdminToggleHabitTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	_, err := db.DB.Exec("UPDATE habit_templates SET is_active = 1 - is_active WHERE id = ?", id)
+	if err != nil {
+		log.Printf("切换习惯模板状态失败: %v", err)
+	}
+
+	http.Redirect(w, r, "/admin/templates", http.StatusSeeOther)
+}
+
+// loadHabitTemplates loads the catalog; activeOnly hides deactivated templates
+func loadHabitTemplates(activeOnly bool) []models.HabitTemplate {
+	query := `
+		SELECT id, COALESCE(code, ''), name, COALESCE(description, ''), category, COALESCE(icon, ''),
+			frequency, target_value, COALESCE(target_unit, ''), COALESCE(routine_kind, ''), sort_order, is_active
+		FROM habit_templates`
+	if activeOnly {
+		query += " WHERE is_active = 1"
+	}
+	query += " ORDER BY sort_order, id"
+
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		log.Printf("Error fetching habit templates: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var templates []models.HabitTemplate
+	for rows.Next() {
+		var t models.HabitTemplate
+		var active int
+		if err := rows.Scan(&t.ID, &t.Code, &t.Name, &t.Description, &t.Category, &t.Icon,
+			&t.Frequency, &t.TargetValue, &t.TargetUnit, &t.RoutineKind, &t.SortOrder, &active); err != nil {
+			log.Printf("Error scanning habit template: %v", err)
+			continue
+		}
+		t.IsActive = active == 1
+		templates = append(templates, t)
+	}
+	return templates
+}
+
+// groupHabitTemplates groups active templates by category for the catalog
+func groupHabitTemplates(templates []models.HabitTemplate) []habitTemplateGroup {
+	var groups []habitTemplateGroup
+	for _, c := range habitTemplateCategories {
+		group := habitTemplateGroup{Key: c.Key, Name: c.Name}
+		for _, t := range templates {
+			if t.Category == c.Key || (c.Key == "other" && habitTemplateCategoryName(t.Category) == "") {
+				group.Templates = append(group.Templates, t)
+			}
+		}
+		if len(group.Templates) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// habitTemplateCategoryName returns the display name of a category, or "" if unknown
+func habitTemplateCategoryName(category string) string {
+	for _, c := range habitTemplateCategories {
+		if c.Key == category {
+			return c.Name
+		}
+	}
+	return ""
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
 	"goblog/auth"
 	"goblog/db"
 	"goblog/models"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,6 +27,9 @@ func HabitsHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		ActivePage     string
 		Habits         []models.Habit
+		Archived       []models.Habit
+		Routines       []models.HabitRoutine
+		TemplateGroups []habitTemplateGroup
 		Badges         []models.Badge
 		TotalHabits    int
 		DoneToday      int
@@ -40,20 +45,31 @@ func HabitsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch Habits for current user
-	rows, err := db.DB.Query("SELECT id, name, description, frequency, streak, total_days FROM habits WHERE user_id = ?", userID)
+	rows, err := db.DB.Query("SELECT id, name, description, frequency, streak, total_days, archived_at, COALESCE(routine_id, 0), sort_order, COALESCE(target_value, 0), COALESCE(target_unit, '') FROM habits WHERE user_id = ? ORDER BY sort_order, id", userID)
 	if err != nil {
 		log.Println(err)
 	} else {
 		defer rows.Close()
 		for rows.Next() {
 			var h models.Habit
-			rows.Scan(&h.ID, &h.Name, &h.Description, &h.Frequency, &h.Streak, &h.TotalDays)
+			var archivedAt sql.NullTime
+			rows.Scan(&h.ID, &h.Name, &h.Description, &h.Frequency, &h.Streak, &h.TotalDays, &archivedAt, &h.RoutineID, &h.SortOrder, &h.TargetValue, &h.TargetUnit)
+
+			// 已归档的习惯不出现在今日列表，只保留统计
+			if archivedAt.Valid {
+				h.Archived = true
+				h.ArchivedAt = archivedAt.Time
+				data.Archived = append(data.Archived, h)
+				continue
+			}
 
 			// Check if habit is already checked today
 			startOfDay := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, time.Local)
-			var count int
-			db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs WHERE habit_id = ? AND date >= ?", h.ID, startOfDay).Scan(&count)
-			h.TodayChecked = count > 0
+			// 今日的打卡记录（含备注、心情和时长）
+			if todayLogs := loadHabitLogs(h.ID, startOfDay, startOfDay.AddDate(0, 0, 1)); len(todayLogs) > 0 {
+				h.TodayLog = todayLogs[0]
+				h.TodayChecked = true
+			}
 
 			if h.TodayChecked {
 				data.DoneToday++
@@ -62,6 +78,10 @@ func HabitsHandler(w http.ResponseWriter, r *http.Request) {
 				data.MaxStreak = h.Streak
 			}
 
+			// 今日是否处于暂停/请假状态，以及当前和未来的暂停记录
+			h.Pauses = loadHabitPauses(h.ID, startOfDay, time.Time{})
+			h.PausedToday = excusedDays(h.Pauses, startOfDay, startOfDay.AddDate(0, 0, 1))[startOfDay.Format("2006-01-02")] != ""
+
 			// 计算本月进度
 			h.MonthlyProgress = calculateMonthlyProgress(h.ID)
 
@@ -70,8 +90,14 @@ func HabitsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 按分组（晨间/晚间例程等）展示今日习惯
+	data.Routines = groupHabitsByRoutine(loadHabitRoutines(userID), data.Habits, time.Now())
+
+	// 习惯模板库
+	data.TemplateGroups = groupHabitTemplates(loadHabitTemplates(true))
+
 	// Fetch Badges for current user
-	bRows, err := db.DB.Query("SELECT id, name, description, icon, unlocked FROM badges WHERE user_id = ?", userID)
+	bRows, err := db.DB.Query("SELECT id, COALESCE(code, ''), name, description, icon, unlocked, unlocked_at FROM badges WHERE user_id = ? ORDER BY id", userID)
 	if err != nil {
 		log.Println(err)
 	} else {
@@ -79,8 +105,12 @@ func HabitsHandler(w http.ResponseWriter, r *http.Request) {
 		for bRows.Next() {
 			var b models.Badge
 			var unlockedInt int
-			bRows.Scan(&b.ID, &b.Name, &b.Description, &b.Icon, &unlockedInt)
+			var unlockedAt sql.NullTime
+			bRows.Scan(&b.ID, &b.Code, &b.Name, &b.Description, &b.Icon, &unlockedInt, &unlockedAt)
 			b.Unlocked = unlockedInt == 1
+			if unlockedAt.Valid {
+				b.UnlockedAt = unlockedAt.Time
+			}
 			data.Badges = append(data.Badges, b)
 			data.TotalBadges++
 			if b.Unlocked {
@@ -104,16 +134,25 @@ func calculateMonthlyProgress(habitID int) int {
 	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
 	endOfMonth := startOfMonth.AddDate(0, 1, 0)
 
-	// 计算本月的总天数
+	// 计算本月的总天数，暂停和请假的日子不计入分母
 	daysInMonth := endOfMonth.Sub(startOfMonth).Hours() / 24
+	excused := excusedDays(loadHabitPauses(habitID, startOfMonth, endOfMonth), startOfMonth, endOfMonth)
+	daysInMonth -= float64(len(excused))
 
-	// 计算本月的打卡天数
-	var checkedDays int
-	err := db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs WHERE habit_id = ? AND date >= ? AND date < ?", habitID, startOfMonth, endOfMonth).Scan(&checkedDays)
+	// 计算本月的打卡天数；和分母一样，暂停和请假日的打卡不计入
+	rows, err := db.DB.Query("SELECT DISTINCT DATE(date) FROM habit_logs WHERE habit_id = ? AND date >= ? AND date < ?", habitID, startOfMonth, endOfMonth)
 	if err != nil {
 		log.Printf("Error calculating monthly progress: %v", err)
 		return 0
 	}
+	defer rows.Close()
+	var checkedDays int
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err == nil && excused[day.Format("2006-01-02")] == "" {
+			checkedDays++
+		}
+	}
 
 	// 计算进度百分比
 	if daysInMonth > 0 {
@@ -145,6 +184,12 @@ func AddHabitHandler(w http.ResponseWriter, r *http.Request) {
 	name := r.FormValue("name")
 	description := r.FormValue("description")
 	frequency := r.FormValue("frequency")
+	routineID, _ := strconv.Atoi(r.FormValue("routine_id"))
+	targetValue, _ := strconv.Atoi(r.FormValue("target_value"))
+	targetUnit := strings.TrimSpace(r.FormValue("target_unit"))
+	if targetValue < 0 {
+		targetValue = 0
+	}
 
 	// Validate input
 	if name == "" {
@@ -162,7 +207,20 @@ func AddHabitHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Adding habit for user %d: name=%s, description=%s, frequency=%s", userID, name, description, frequency)
 
-	_, err := db.DB.Exec("INSERT INTO habits (user_id, name, description, frequency) VALUES (?, ?, ?, ?)", userID, name, description, frequency)
+	// 只接受属于当前用户的分组，新习惯排在分组末尾
+	var routine interface{}
+	if routineID > 0 {
+		var count int
+		db.DB.QueryRow("SELECT COUNT(*) FROM habit_routines WHERE id = ? AND user_id = ?", routineID, userID).Scan(&count)
+		if count > 0 {
+			routine = routineID
+		}
+	}
+	var maxOrder sql.NullInt64
+	db.DB.QueryRow("SELECT MAX(sort_order) FROM habits WHERE user_id = ?", userID).Scan(&maxOrder)
+
+	_, err := db.DB.Exec("INSERT INTO habits (user_id, name, description, frequency, routine_id, sort_order, target_value, target_unit) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, name, description, frequency, routine, maxOrder.Int64+1, targetValue, targetUnit)
 	if err != nil {
 		log.Printf("Error adding habit: %v", err)
 		// 即使出错也要重定向回习惯页面，让用户知道操作已完成
@@ -173,7 +231,45 @@ func AddHabitHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/habits", http.StatusSeeOther)
 }
 
-// DeleteHabitHandler deletes a habit
+// ArchiveHabitHandler archives a habit, hiding it from the daily list but keeping its logs
+func ArchiveHabitHandler(w http.ResponseWriter, r *http.Request) {
+	setHabitArchived(w, r, true)
+}
+
+// UnarchiveHabitHandler restores an archived habit to the daily list
+func UnarchiveHabitHandler(w http.ResponseWriter, r *http.Request) {
+	setHabitArchived(w, r, false)
+}
+
+func setHabitArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	var archivedAt interface{}
+	if archived {
+		archivedAt = time.Now()
+	}
+
+	_, err := db.DB.Exec("UPDATE habits SET archived_at = ? WHERE id = ? AND user_id = ?", archivedAt, id, userID)
+	if err != nil {
+		log.Println("Error archiving habit:", err)
+	}
+
+	http.Redirect(w, r, "/habits", http.StatusSeeOther)
+}
+
+// DeleteHabitHandler permanently deletes an archived habit and all of its history
 func DeleteHabitHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/habits", http.StatusSeeOther)
@@ -189,12 +285,34 @@ func DeleteHabitHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, _ := strconv.Atoi(r.FormValue("id"))
 
-	// Delete logs first (foreign key)
-	_, err := db.DB.Exec("DELETE FROM habit_logs WHERE habit_id = ?", id)
+	// 只能永久删除已归档的习惯，并且需要输入习惯名称确认
+	var name string
+	var archivedAt sql.NullTime
+	err := db.DB.QueryRow("SELECT name, archived_at FROM habits WHERE id = ? AND user_id = ?", id, userID).Scan(&name, &archivedAt)
+	if err != nil {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+	if !archivedAt.Valid {
+		http.Error(w, "请先归档习惯，再永久删除", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("confirm_name") != name {
+		http.Error(w, "确认名称不匹配，未删除", http.StatusBadRequest)
+		return
+	}
+
+	// Delete logs and pauses first (foreign key)
+	_, err = db.DB.Exec("DELETE hl FROM habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id WHERE hl.habit_id = ? AND h.user_id = ?", id, userID)
 	if err != nil {
 		log.Println("Error deleting habit logs:", err)
 	}
 
+	_, err = db.DB.Exec("DELETE hp FROM habit_pauses hp INNER JOIN habits h ON hp.habit_id = h.id WHERE hp.habit_id = ? AND h.user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error deleting habit pauses:", err)
+	}
+
 	_, err = db.DB.Exec("DELETE FROM habits WHERE id = ? AND user_id = ?", id, userID)
 	if err != nil {
 		log.Println("Error deleting habit:", err)
@@ -218,12 +336,20 @@ func CheckinHabitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	habitID, _ := strconv.Atoi(r.FormValue("habit_id"))
+	note, mood, duration := parseHabitLogForm(r)
 	now := time.Now()
 
+	// Verify habit belongs to user and is not archived
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM habits WHERE id = ? AND user_id = ? AND archived_at IS NULL", habitID, userID).Scan(&count)
+	if err != nil || count == 0 {
+		http.Redirect(w, r, "/habits", http.StatusSeeOther)
+		return
+	}
+
 	// Check if already checked in today
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
-	var count int
-	err := db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id WHERE hl.habit_id = ? AND hl.date >= ? AND h.user_id = ?", habitID, startOfDay, userID).Scan(&count)
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs hl INNER JOIN habits h ON hl.habit_id = h.id WHERE hl.habit_id = ? AND hl.date >= ? AND h.user_id = ?", habitID, startOfDay, userID).Scan(&count)
 	if err != nil {
 		log.Println(err)
 		http.Redirect(w, r, "/habits", http.StatusSeeOther)
@@ -235,7 +361,7 @@ func CheckinHabitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Record Log
-	_, err = db.DB.Exec("INSERT INTO habit_logs (habit_id, date) VALUES (?, ?)", habitID, now)
+	_, err = db.DB.Exec("INSERT INTO habit_logs (habit_id, date, note, mood, duration_minutes) VALUES (?, ?, ?, ?, ?)", habitID, now, note, mood, duration)
 	if err != nil {
 		log.Println("Error log habit:", err)
 		http.Redirect(w, r, "/habits", http.StatusSeeOther)
@@ -243,9 +369,10 @@ func CheckinHabitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update Streak and Total
-	yesterday := startOfDay.AddDate(0, 0, -1)
+	// 跳过暂停/请假的日子，找到上一个需要打卡的日子
+	yesterday := previousDueDay(habitID, startOfDay)
 	var yesterdayCount int
-	db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs WHERE habit_id = ? AND date >= ? AND date < ?", habitID, yesterday, startOfDay).Scan(&yesterdayCount)
+	db.DB.QueryRow("SELECT COUNT(*) FROM habit_logs WHERE habit_id = ? AND date >= ? AND date < ?", habitID, yesterday, yesterday.AddDate(0, 0, 1)).Scan(&yesterdayCount)
 
 	var streak int
 	var totalDays int
@@ -265,25 +392,7 @@ func CheckinHabitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check Badges for current user
-	checkBadges(userID, totalDays, streak)
+	EvaluateBadges(userID)
 
 	http.Redirect(w, r, "/habits", http.StatusSeeOther)
 }
-
-func checkBadges(userID, totalDays, streak int) {
-	rows, err := db.DB.Query("SELECT id, condition_days, unlocked FROM badges WHERE user_id = ? AND unlocked = 0", userID)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id, days int
-		var unlocked int
-		rows.Scan(&id, &days, &unlocked)
-
-		if totalDays >= days || streak >= days {
-			db.DB.Exec("UPDATE badges SET unlocked = 1 WHERE id = ? AND user_id = ?", id, userID)
-		}
-	}
-}
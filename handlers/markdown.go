@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Diary entries are written in a small Markdown subset:
+//
+//	# 标题 ... ###### 标题
+//	- 列表 / 1. 有序列表，缩进两格嵌套
+//	- [ ] 待办 / - [x] 已完成
+//	> 引用
+//	```代码块```、`行内代码`
+//	**粗体**、*斜体*、~~删除线~~、[链接](https://...)、![图片](https://...)
+//	--- 分割线
+//
+// The renderer never passes user HTML through: all text is escaped and only
+// http(s), mailto and relative URLs are linked.
+
+const maxMarkdownDepth = 8 // 引用和列表嵌套的最大层数
+
+var (
+	mdHeading     = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	mdRule        = regexp.MustCompile(`^ {0,3}([-*_])([ \t]*[-*_]){2,}[ \t]*$`)
+	mdListItem    = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])[ \t]+(.*)$`)
+	mdFence       = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([A-Za-z0-9_+-]*)")
+	mdURLScheme   = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+	mdSafeSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+)
+
+// renderMarkdown converts diary Markdown to safe HTML
+func renderMarkdown(src string) template.HTML {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	var b strings.Builder
+	renderMarkdownBlocks(&b, strings.Split(src, "\n"), 0)
+	return template.HTML(b.String())
+}
+
+// renderMarkdownBlocks renders block elements: headings, rules, fenced code,
+// quotes, lists and paragraphs
+func renderMarkdownBlocks(b *strings.Builder, lines []string, depth int) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		for i, line := range paragraph {
+			if i > 0 {
+				b.WriteString("<br>\n")
+			}
+			b.WriteString(renderMarkdownInline(strings.TrimSpace(line)))
+		}
+		b.WriteString("</p>\n")
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case mdFence.MatchString(line):
+			flush()
+			m := mdFence.FindStringSubmatch(line)
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			if m[2] != "" {
+				b.WriteString(`<pre><code class="language-` + m[2] + `">`)
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>\n")
+
+		case mdHeading.MatchString(trimmed):
+			flush()
+			m := mdHeading.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">" + renderMarkdownInline(m[2]) + "</h" + level + ">\n")
+
+		case mdRule.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if !strings.HasPrefix(t, ">") {
+					i--
+					break
+				}
+				t = strings.TrimPrefix(t, ">")
+				quote = append(quote, strings.TrimPrefix(t, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			if depth < maxMarkdownDepth {
+				renderMarkdownBlocks(b, quote, depth+1)
+			} else {
+				b.WriteString("<p>" + html.EscapeString(strings.Join(quote, " ")) + "</p>\n")
+			}
+			b.WriteString("</blockquote>\n")
+
+		case mdListItem.MatchString(line):
+			flush()
+			i = renderMarkdownList(b, lines, i, depth)
+
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+}
+
+// renderMarkdownList renders the list starting at lines[start] and returns the
+// index of its last line. Items indented deeper than the first item become a
+// nested list inside the previous item.
+func renderMarkdownList(b *strings.Builder, lines []string, start, depth int) int {
+	first := mdListItem.FindStringSubmatch(lines[start])
+	indent := markdownIndent(first[1])
+	ordered := !strings.ContainsAny(first[2][:1], "-*+")
+
+	if ordered {
+		b.WriteString("<ol>\n")
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	i := start
+	open := false
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			// 空行之后如果不是同一列表的项目，列表结束
+			if i+1 < len(lines) && mdListItem.MatchString(lines[i+1]) {
+				continue
+			}
+			break
+		}
+		m := mdListItem.FindStringSubmatch(line)
+		if m == nil {
+			if markdownIndent(leadingSpace(line)) > indent && open {
+				// 缩进的续行属于当前项目
+				b.WriteString("<br>\n" + renderMarkdownInline(strings.TrimSpace(line)))
+				continue
+			}
+			break
+		}
+
+		itemIndent := markdownIndent(m[1])
+		if itemIndent > indent+1 && open && depth < maxMarkdownDepth {
+			b.WriteString("\n")
+			i = renderMarkdownList(b, lines, i, depth+1)
+			continue
+		}
+		if itemIndent < indent || ordered == strings.ContainsAny(m[2][:1], "-*+") {
+			// 回到上一层，或换成了另一种列表
+			break
+		}
+
+		if open {
+			b.WriteString("</li>\n")
+		}
+		text := m[3]
+		switch {
+		case strings.HasPrefix(text, "[ ] "):
+			b.WriteString(`<li class="task-item"><input type="checkbox" disabled> ` + renderMarkdownInline(text[4:]))
+		case strings.HasPrefix(text, "[x] "), strings.HasPrefix(text, "[X] "):
+			b.WriteString(`<li class="task-item"><input type="checkbox" checked disabled> ` + renderMarkdownInline(text[4:]))
+		default:
+			b.WriteString("<li>" + renderMarkdownInline(text))
+		}
+		open = true
+	}
+	if open {
+		b.WriteString("</li>\n")
+	}
+
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i - 1
+}
+
+// renderMarkdownInline renders code spans, emphasis, links, images and bare
+// URLs within one line; everything else is escaped
+func renderMarkdownInline(s string) string {
+	var b strings.Builder
+	var text strings.Builder
+	flushText := func() {
+		b.WriteString(html.EscapeString(text.String()))
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!~>|", s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			run := len(rest) - len(strings.TrimLeft(rest, "`"))
+			fence := rest[:run]
+			if end := strings.Index(rest[run:], fence); end >= 0 {
+				flushText()
+				code := strings.TrimSpace(rest[run : run+end])
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += run + end + run
+				continue
+			}
+			text.WriteString(fence)
+			i += run
+			continue
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if inner, n, ok := markdownDelimited(rest, rest[:2]); ok {
+				flushText()
+				b.WriteString("<strong>" + renderMarkdownInline(inner) + "</strong>")
+				i += n
+				continue
+			}
+
+		case strings.HasPrefix(rest, "~~"):
+			if inner, n, ok := markdownDelimited(rest, "~~"); ok {
+				flushText()
+				b.WriteString("<del>" + renderMarkdownInline(inner) + "</del>")
+				i += n
+				continue
+			}
+
+		case c == '*' || (c == '_' && (i == 0 || !isWordByte(s[i-1]))):
+			if inner, n, ok := markdownDelimited(rest, rest[:1]); ok && (c == '*' || i+n >= len(s) || !isWordByte(s[i+n])) {
+				flushText()
+				b.WriteString("<em>" + renderMarkdownInline(inner) + "</em>")
+				i += n
+				continue
+			}
+
+		case c == '!' && strings.HasPrefix(rest, "!["):
+			if label, target, n, ok := markdownLink(rest[1:]); ok {
+				if href, safe := safeMarkdownURL(target); safe {
+					flushText()
+					b.WriteString(`<img src="` + href + `" alt="` + html.EscapeString(label) + `" loading="lazy">`)
+					i += 1 + n
+					continue
+				}
+			}
+
+		case c == '[':
+			if label, target, n, ok := markdownLink(rest); ok {
+				flushText()
+				if href, safe := safeMarkdownURL(target); safe {
+					b.WriteString(`<a href="` + href + `" target="_blank" rel="noopener noreferrer nofollow">` + renderMarkdownInline(label) + `</a>`)
+				} else {
+					// 不安全的链接（如 javascript:）只保留文字
+					b.WriteString(renderMarkdownInline(label))
+				}
+				i += n
+				continue
+			}
+
+		case (strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://")) && (i == 0 || !isWordByte(s[i-1])):
+			end := 0
+			for end < len(rest) {
+				r := rest[end]
+				if r <= ' ' || r >= utf8.RuneSelf || strings.IndexByte(`<>"'`, r) >= 0 {
+					break
+				}
+				end++
+			}
+			url := strings.TrimRight(rest[:end], ".,;:!?)")
+			if href, safe := safeMarkdownURL(url); safe {
+				flushText()
+				b.WriteString(`<a href="` + href + `" target="_blank" rel="noopener noreferrer nofollow">` + html.EscapeString(url) + `</a>`)
+				i += len(url)
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		text.WriteString(rest[:size])
+		i += size
+	}
+	flushText()
+	return b.String()
+}
+
+// markdownDelimited matches "**inner**" at the start of s and returns inner
+// and the total length
+func markdownDelimited(s, delim string) (string, int, bool) {
+	body := s[len(delim):]
+	end := strings.Index(body, delim)
+	if end <= 0 {
+		return "", 0, false
+	}
+	inner := body[:end]
+	// 分隔符内侧不能是空白，避免把 "2 * 3 * 4" 当成斜体
+	first, _ := utf8.DecodeRuneInString(inner)
+	last, _ := utf8.DecodeLastRuneInString(inner)
+	if unicode.IsSpace(first) || unicode.IsSpace(last) {
+		return "", 0, false
+	}
+	return inner, len(delim) + end + len(delim), true
+}
+
+// markdownLink matches "[label](target)" at the start of s
+func markdownLink(s string) (label, target string, n int, ok bool) {
+	level := 0
+	closeBracket := -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			level++
+		case ']':
+			level--
+			if level == 0 {
+				closeBracket = i
+			}
+		}
+		if closeBracket >= 0 {
+			break
+		}
+	}
+	if closeBracket < 0 || closeBracket+1 >= len(s) || s[closeBracket+1] != '(' {
+		return "", "", 0, false
+	}
+	// 目标中允许成对的括号，如 https://zh.wikipedia.org/wiki/Go_(编程语言)
+	end, level := -1, 0
+	for i, c := range s[closeBracket+2:] {
+		if c == '(' {
+			level++
+		} else if c == ')' {
+			if level == 0 {
+				end = i
+				break
+			}
+			level--
+		}
+	}
+	if end < 0 {
+		return "", "", 0, false
+	}
+	target = strings.TrimSpace(s[closeBracket+2 : closeBracket+2+end])
+	// 忽略链接标题：[文字](url "标题")
+	if sp := strings.IndexAny(target, " \t"); sp >= 0 {
+		target = target[:sp]
+	}
+	target = strings.Trim(target, "<>")
+	return s[1:closeBracket], target, closeBracket + 2 + end + 1, true
+}
+
+// safeMarkdownURL returns the escaped URL when it is relative or uses an
+// allowed scheme
+func safeMarkdownURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	for _, r := range raw {
+		if r < ' ' || r == 0x7f {
+			return "", false
+		}
+	}
+	if m := mdURLScheme.FindStringSubmatch(raw); m != nil && !mdSafeSchemes[strings.ToLower(m[1])] {
+		return "", false
+	}
+	// "//evil.com" 这样的协议相对地址也指向外站，按外链处理即可；反斜杠会被
+	// 部分浏览器当成斜杠，一律拒绝
+	if strings.Contains(raw, `\`) {
+		return "", false
+	}
+	return html.EscapeString(raw), true
+}
+
+// markdownExcerpt strips Markdown syntax for plain-text previews
+func markdownExcerpt(src string) string {
+	var parts []string
+	inFence := false
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		if mdFence.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if inFence || line == "" || mdRule.MatchString(line) {
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			line = m[2]
+		}
+		if m := mdListItem.FindStringSubmatch(line); m != nil {
+			line = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(m[3], "[ ] "), "[x] "), "[X] ")
+		}
+		line = strings.TrimLeft(line, "> ")
+		parts = append(parts, line)
+	}
+	text := strings.Join(parts, " ")
+	text = mdExcerptLink.ReplaceAllString(text, "$1")
+	return mdExcerptMarks.Replace(text)
+}
+
+var (
+	mdExcerptLink  = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	mdExcerptMarks = strings.NewReplacer("**", "", "__", "", "~~", "", "`", "", "*", "")
+)
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// markdownIndent counts indentation columns, a tab being four
+func markdownIndent(space string) int {
+	n := 0
+	for _, c := range space {
+		if c == '\t' {
+			n += 4
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
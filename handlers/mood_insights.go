@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"fmt"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// moodLevel is a diary mood emoji and its score
+type moodLevel struct {
+	Mood  string
+	Score int
+	Label string
+}
+
+// moodScale maps the diary mood emojis to a 1-5 score
+var moodScale = []moodLevel{
+	{"🥰", 5, "幸福"},
+	{"😊", 4, "开心"},
+	{"😎", 4, "得意"},
+	{"🤔", 3, "平静"},
+	{"😴", 3, "疲惫"},
+	{"😔", 2, "低落"},
+	{"😤", 2, "烦躁"},
+	{"😡", 1, "生气"},
+}
+
+var moodInsightRanges = []int{30, 90, 180, 365}
+
+const (
+	maxMoodScore          = 5
+	minCorrelationSamples = 5 // 少于 5 天的数据不计算相关系数
+)
+
+// moodScore returns the score of a mood emoji; ok is false for moods that
+// are not on the scale
+func moodScore(mood string) (int, bool) {
+	for _, m := range moodScale {
+		if m.Mood == mood {
+			return m.Score, true
+		}
+	}
+	return 0, false
+}
+
+// MoodInsightsHandler shows mood trends and how mood relates to habits,
+// spending and weather (?days=30|90|180|365)
+func MoodInsightsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, _ := auth.ValidateSession(r)
+
+	days := 90
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil {
+		for _, allowed := range moodInsightRanges {
+			if d == allowed {
+				days = d
+			}
+		}
+	}
+
+	insights, err := loadMoodInsights(userID, days, time.Now())
+	if err != nil {
+		log.Printf("统计心情失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 趋势图数据
+	var chartLabels []string
+	var chartScores, chartAverages []float64
+	for _, p := range insights.Trend {
+		chartLabels = append(chartLabels, p.Date[5:])
+		chartScores = append(chartScores, p.Score)
+		chartAverages = append(chartAverages, p.Average)
+	}
+
+	data := struct {
+		Insights      models.MoodInsights
+		Ranges        []int
+		Scale         []moodLevel
+		ChartLabels   []string
+		ChartScores   []float64
+		ChartAverages []float64
+		ActivePage    string
+		User          *auth.Session
+		IsLoggedIn    bool
+	}{
+		Insights:      insights,
+		Ranges:        moodInsightRanges,
+		Scale:         moodScale,
+		ChartLabels:   chartLabels,
+		ChartScores:   chartScores,
+		ChartAverages: chartAverages,
+		ActivePage:    "diary",
+		User:          session,
+		IsLoggedIn:    session != nil,
+	}
+
+	renderTemplate(w, "mood_insights.html", data)
+}
+
+// loadMoodInsights aggregates the moods of the last `days` days up to now
+func loadMoodInsights(userID, days int, now time.Time) (models.MoodInsights, error) {
+	insights := models.MoodInsights{Days: days}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	start := today.AddDate(0, 0, -(days - 1))
+	end := today.AddDate(0, 0, 1)
+
+	rows, err := db.DB.Query(`
+		SELECT date, mood, weather
+		FROM diaries
+		WHERE user_id = ? AND date >= ? AND date < ?
+		ORDER BY date
+	`, userID, start, end)
+	if err != nil {
+		return insights, err
+	}
+	defer rows.Close()
+
+	type scoreSum struct {
+		total float64
+		count int
+	}
+	byDay := make(map[string]*scoreSum)
+	byWeather := make(map[string]*scoreSum)
+	moodCounts := make(map[string]int)
+	for rows.Next() {
+		var date time.Time
+		var mood, weather string
+		if err := rows.Scan(&date, &mood, &weather); err != nil {
+			return insights, err
+		}
+		score, ok := moodScore(mood)
+		if !ok {
+			continue
+		}
+		moodCounts[mood]++
+
+		key := date.Format("2006-01-02")
+		if byDay[key] == nil {
+			byDay[key] = &scoreSum{}
+		}
+		byDay[key].total += float64(score)
+		byDay[key].count++
+
+		label := diaryWeatherLabel(weather)
+		if byWeather[label] == nil {
+			byWeather[label] = &scoreSum{}
+		}
+		byWeather[label].total += float64(score)
+		byWeather[label].count++
+	}
+	if err := rows.Err(); err != nil {
+		return insights, err
+	}
+
+	// 每天的平均心情；一天写了多篇日记时取平均
+	daily := make(map[string]float64, len(byDay))
+	var dayKeys []string
+	total := 0.0
+	for key, sum := range byDay {
+		daily[key] = sum.total / float64(sum.count)
+		dayKeys = append(dayKeys, key)
+		total += daily[key]
+	}
+	sort.Strings(dayKeys)
+	insights.Entries = len(dayKeys)
+	if insights.Entries == 0 {
+		return insights, nil
+	}
+	insights.Average = roundMood(total / float64(insights.Entries))
+
+	// 趋势：每天的分数和 7 天移动平均
+	for _, key := range dayKeys {
+		day, _ := time.ParseInLocation("2006-01-02", key, time.Local)
+		sum, n := 0.0, 0
+		for i := 0; i < 7; i++ {
+			if score, ok := daily[day.AddDate(0, 0, -i).Format("2006-01-02")]; ok {
+				sum += score
+				n++
+			}
+		}
+		insights.Trend = append(insights.Trend, models.MoodPoint{
+			Date:    key,
+			Score:   roundMood(daily[key]),
+			Average: roundMood(sum / float64(n)),
+		})
+	}
+
+	// 按星期：周一在前
+	var weekdays [7]scoreSum
+	for _, key := range dayKeys {
+		day, _ := time.ParseInLocation("2006-01-02", key, time.Local)
+		weekdays[day.Weekday()].total += daily[key]
+		weekdays[day.Weekday()].count++
+	}
+	for i := 1; i <= 7; i++ {
+		wd := time.Weekday(i % 7)
+		insights.ByWeekday = append(insights.ByWeekday, moodGroup("周"+weekdayNames[wd], weekdays[wd].total, weekdays[wd].count))
+	}
+
+	// 按天气：按 diaryWeatherOptions 的顺序，其他天气放最后
+	weatherLabels := []string{}
+	for _, opt := range diaryWeatherOptions {
+		weatherLabels = append(weatherLabels, opt.Label)
+	}
+	for _, label := range append(weatherLabels, diaryWeatherLabel("")) {
+		if sum := byWeather[label]; sum != nil {
+			insights.ByWeather = append(insights.ByWeather, moodGroup(label, sum.total, sum.count))
+		}
+	}
+
+	// 心情分布
+	maxCount := 0
+	for _, count := range moodCounts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+	for _, m := range moodScale {
+		if count := moodCounts[m.Mood]; count > 0 {
+			insights.ByMood = append(insights.ByMood, models.MoodGroup{
+				Label:   m.Mood + " " + m.Label,
+				Count:   count,
+				Average: float64(m.Score),
+				Percent: count * 100 / maxCount,
+			})
+		}
+	}
+
+	habits := dailyMetric(`
+		SELECT DATE(hl.date), COUNT(*)
+		FROM habit_logs hl
+		JOIN habits h ON h.id = hl.habit_id
+		WHERE h.user_id = ? AND hl.date >= ? AND hl.date < ?
+		GROUP BY DATE(hl.date)
+	`, userID, start, end)
+	insights.Correlations = append(insights.Correlations,
+		moodCorrelation("习惯打卡", "每天打卡次数", daily, dayKeys, habits, "有打卡的日子", "没有打卡的日子", func(v float64) bool { return v > 0 }))
+
+	spending := dailyMetric(`
+		SELECT DATE(date), COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE user_id = ? AND type = 'expense' AND date >= ? AND date < ?
+		GROUP BY DATE(date)
+	`, userID, start, end)
+	median := medianOf(dayKeys, spending)
+	insights.Correlations = append(insights.Correlations,
+		moodCorrelation("每日支出", "每天支出金额", daily, dayKeys, spending,
+			fmt.Sprintf("支出高于 ¥%.0f 的日子", median), fmt.Sprintf("支出不超过 ¥%.0f 的日子", median),
+			func(v float64) bool { return v > median }))
+
+	return insights, nil
+}
+
+// dailyMetric runs a "SELECT DATE(...), value ... GROUP BY DATE(...)" query
+// and returns the values keyed by day; errors are logged and yield no data
+func dailyMetric(query string, args ...interface{}) map[string]float64 {
+	values := make(map[string]float64)
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error fetching daily metric: %v", err)
+		return values
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day time.Time
+		var value float64
+		if err := rows.Scan(&day, &value); err == nil {
+			values[day.Format("2006-01-02")] = value
+		}
+	}
+	return values
+}
+
+// moodCorrelation computes the Pearson correlation between daily mood and a
+// metric over the days that have a mood, and compares the average mood of
+// the days where high(metric) holds with the rest
+func moodCorrelation(module, metric string, daily map[string]float64, dayKeys []string, values map[string]float64,
+	highLabel, lowLabel string, high func(float64) bool) models.MoodCorrelation {
+	c := models.MoodCorrelation{Module: module, Metric: metric, Days: len(dayKeys)}
+
+	var xs, ys []float64
+	var highSum, lowSum float64
+	var highCount, lowCount int
+	for _, key := range dayKeys {
+		v := values[key] // 没有记录的日子按 0 计
+		xs = append(xs, v)
+		ys = append(ys, daily[key])
+		if high(v) {
+			highSum += daily[key]
+			highCount++
+		} else {
+			lowSum += daily[key]
+			lowCount++
+		}
+	}
+	c.Compare = []models.MoodGroup{
+		moodGroup(highLabel, highSum, highCount),
+		moodGroup(lowLabel, lowSum, lowCount),
+	}
+
+	if len(xs) < minCorrelationSamples {
+		return c
+	}
+	r, ok := pearson(xs, ys)
+	if !ok {
+		return c
+	}
+	c.Valid = true
+	c.R = math.Round(r*100) / 100
+	c.Strength = correlationStrength(r)
+	return c
+}
+
+func moodGroup(label string, total float64, count int) models.MoodGroup {
+	g := models.MoodGroup{Label: label, Count: count}
+	if count > 0 {
+		g.Average = roundMood(total / float64(count))
+		g.Percent = int(g.Average * 100 / maxMoodScore)
+	}
+	return g
+}
+
+// pearson returns the correlation coefficient of xs and ys; ok is false when
+// either series is constant
+func pearson(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
+
+func correlationStrength(r float64) string {
+	direction := "正相关"
+	if r < 0 {
+		direction = "负相关"
+	}
+	switch a := math.Abs(r); {
+	case a < 0.1:
+		return "几乎没有关系"
+	case a < 0.3:
+		return "弱" + direction
+	case a < 0.5:
+		return "中等" + direction
+	default:
+		return "强" + direction
+	}
+}
+
+// medianOf returns the median metric value over the given days
+func medianOf(dayKeys []string, values map[string]float64) float64 {
+	if len(dayKeys) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(dayKeys))
+	for i, key := range dayKeys {
+		sorted[i] = values[key]
+	}
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func roundMood(v float64) float64 {
+	return math.Round(v*10) / 10
+}
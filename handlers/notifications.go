@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"fmt"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// todoReminderLeadTime 截止时间前多久发出"即将到期"提醒
+const todoReminderLeadTime = time.Hour
+
+// StartReminderScheduler checks todo due dates and the daily diary digest
+// every interval and writes reminders into the users' inboxes. It blocks, so
+// run it in a goroutine.
+func StartReminderScheduler(interval time.Duration) {
+	log.Printf("提醒调度器已启动，检查间隔: %s", interval)
+	checkTodoReminders(time.Now())
+	checkDiaryDigests(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		checkTodoReminders(now)
+		checkDiaryDigests(now)
+	}
+}
+
+// checkTodoReminders notifies about pending todos that are due within the
+// lead time or already overdue. Each todo is reminded once per due date and
+// kind, so rescheduling a todo reminds again.
+func checkTodoReminders(now time.Time) {
+	if db.DB == nil {
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, user_id, content, due_date
+		FROM todos
+		WHERE status = 'pending' AND due_date IS NOT NULL AND due_date <= ?
+	`, now.Add(todoReminderLeadTime))
+	if err != nil {
+		log.Printf("检查待办提醒失败: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type dueTodo struct {
+		ID      int
+		UserID  int
+		Content string
+		DueDate time.Time
+	}
+	var todos []dueTodo
+	for rows.Next() {
+		var t dueTodo
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Content, &t.DueDate); err != nil {
+			log.Printf("扫描待办提醒失败: %v", err)
+			continue
+		}
+		todos = append(todos, t)
+	}
+	rows.Close()
+
+	for _, t := range todos {
+		kind, title := "todo_due_soon", "任务即将到期："+t.Content
+		if !t.DueDate.After(now) {
+			kind, title = "todo_overdue", "任务已过期："+t.Content
+		}
+		key := fmt.Sprintf("%s:%d:%s", kind, t.ID, t.DueDate.Format("200601021504"))
+		body := "截止时间 " + t.DueDate.Format("2006-01-02 15:04")
+		createNotification(t.UserID, kind, title, body, fmt.Sprintf("/todos/checkins?id=%d", t.ID), key)
+	}
+}
+
+// createNotification adds an inbox entry unless one with the same dedupe key exists
+func createNotification(userID int, kind, title, body, link, dedupeKey string) {
+	if runes := []rune(title); len(runes) > 255 {
+		title = string(runes[:255])
+	}
+	_, err := db.DB.Exec(
+		"INSERT IGNORE INTO notifications (user_id, kind, title, body, link, dedupe_key) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, kind, title, body, link, dedupeKey,
+	)
+	if err != nil {
+		log.Printf("写入通知失败: %v", err)
+	}
+}
+
+// InboxHandler renders the notification inbox
+func InboxHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user session
+	session, _ := auth.ValidateSession(r)
+
+	data := struct {
+		ActivePage    string
+		Notifications []models.Notification
+		UnreadCount   int
+		User          *auth.Session
+		IsLoggedIn    bool
+	}{
+		ActivePage: "inbox",
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, kind, title, COALESCE(body, ''), COALESCE(link, ''), is_read, created_at
+		FROM notifications
+		WHERE user_id = ?
+		ORDER BY is_read, created_at DESC, id DESC
+		LIMIT 200
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching notifications: %v", err)
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var n models.Notification
+			var read int
+			if err := rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Body, &n.Link, &read, &n.CreatedAt); err != nil {
+				log.Printf("Error scanning notification: %v", err)
+				continue
+			}
+			n.IsRead = read == 1
+			if !n.IsRead {
+				data.UnreadCount++
+			}
+			data.Notifications = append(data.Notifications, n)
+		}
+	}
+
+	renderTemplate(w, "inbox.html", data)
+}
+
+// ReadNotificationHandler marks one notification as read, or all of them when id is 0
+func ReadNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/inbox", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	var err error
+	if id > 0 {
+		_, err = db.DB.Exec("UPDATE notifications SET is_read = 1 WHERE id = ? AND user_id = ?", id, userID)
+	} else {
+		_, err = db.DB.Exec("UPDATE notifications SET is_read = 1 WHERE user_id = ? AND is_read = 0", userID)
+	}
+	if err != nil {
+		log.Println("Error marking notifications as read:", err)
+	}
+
+	http.Redirect(w, r, "/inbox", http.StatusSeeOther)
+}
+
+// OpenNotificationHandler marks a notification as read and follows its link
+func OpenNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+	var link string
+	err := db.DB.QueryRow("SELECT COALESCE(link, '') FROM notifications WHERE id = ? AND user_id = ?", id, userID).Scan(&link)
+	if err != nil {
+		http.Redirect(w, r, "/inbox", http.StatusSeeOther)
+		return
+	}
+
+	_, err = db.DB.Exec("UPDATE notifications SET is_read = 1 WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error marking notification as read:", err)
+	}
+
+	// 只跳转到站内链接
+	if link == "" || link[0] != '/' || (len(link) > 1 && link[1] == '/') {
+		link = "/inbox"
+	}
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
+
+// unreadNotificationCount returns the number of unread inbox entries shown in the sidebar
+func unreadNotificationCount(session *auth.Session) int {
+	if session == nil || db.DB == nil {
+		return 0
+	}
+	var count int
+	db.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = 0", session.UserID).Scan(&count)
+	return count
+}
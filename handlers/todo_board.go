@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TodoBoardHandler renders the kanban board of top-level todos
+func TodoBoardHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user session
+	session, _ := auth.ValidateSession(r)
+
+	data := struct {
+		ActivePage   string
+		Columns      []models.TodoColumn
+		PendingCount int
+		DoneCount    int
+		User         *auth.Session
+		IsLoggedIn   bool
+	}{
+		ActivePage: "todos",
+		Columns:    loadTodoBoard(userID),
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	for _, c := range data.Columns {
+		if c.IsDone {
+			data.DoneCount += len(c.Todos)
+		} else {
+			data.PendingCount += len(c.Todos)
+		}
+	}
+
+	renderTemplate(w, "todo_board.html", data)
+}
+
+// MoveTodoHandler moves a todo to a board column and saves the column's order.
+// Moving into or out of a done column completes or reopens the todo.
+func MoveTodoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		TodoID   int   `json:"todo_id"`
+		ColumnID int   `json:"column_id"`
+		TodoIDs  []int `json:"todo_ids"` // 目标列中任务的新顺序
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	columns := loadTodoBoard(userID)
+	target := -1
+	current := -1
+	for i, c := range columns {
+		if c.ID == request.ColumnID {
+			target = i
+		}
+		for _, t := range c.Todos {
+			if t.ID == request.TodoID {
+				current = i
+			}
+		}
+	}
+	if target < 0 {
+		http.Error(w, "看板列不存在", http.StatusNotFound)
+		return
+	}
+	if current < 0 {
+		http.Error(w, "任务不存在", http.StatusNotFound)
+		return
+	}
+
+	column := columns[target]
+	if current != target && column.WIPLimit > 0 && len(column.Todos) >= column.WIPLimit {
+		http.Error(w, "「"+column.Name+"」已达到 WIP 上限 "+strconv.Itoa(column.WIPLimit)+"，请先完成或移走其中的任务", http.StatusConflict)
+		return
+	}
+
+	var status string
+	var parentID int
+	err := db.DB.QueryRow("SELECT status, COALESCE(parent_id, 0) FROM todos WHERE id = ? AND user_id = ?", request.TodoID, userID).Scan(&status, &parentID)
+	if err != nil {
+		http.Error(w, "任务不存在", http.StatusNotFound)
+		return
+	}
+	newStatus := "pending"
+	if column.IsDone {
+		newStatus = "completed"
+	}
+
+	_, err = db.DB.Exec("UPDATE todos SET column_id = ?, status = ?, "+todoCompletedAtSQL+" WHERE id = ? AND user_id = ?", column.ID, newStatus, request.TodoID, userID)
+	if err != nil {
+		http.Error(w, "Error moving todo", http.StatusInternalServerError)
+		return
+	}
+	if newStatus != status {
+		afterTodoStatusChange(userID, request.TodoID, parentID, newStatus)
+	}
+
+	// Save order within the column; user_id guards against foreign IDs
+	for i, id := range request.TodoIDs {
+		_, err := db.DB.Exec("UPDATE todos SET board_order = ? WHERE id = ? AND user_id = ?", i+1, id, userID)
+		if err != nil {
+			http.Error(w, "Error updating todo order", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Todo moved successfully", "status": newStatus})
+}
+
+// AddTodoColumnHandler appends a column to the user's board
+func AddTodoColumnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name, color, wipLimit, isDone, ok := parseTodoColumnForm(r)
+	if !ok {
+		http.Error(w, "列名称不能为空", http.StatusBadRequest)
+		return
+	}
+
+	db.CreateUserTodoColumns(userID) // 第一次添加列时先补上默认列
+	var maxOrder sql.NullInt64
+	db.DB.QueryRow("SELECT MAX(sort_order) FROM todo_columns WHERE user_id = ?", userID).Scan(&maxOrder)
+
+	_, err := db.DB.Exec("INSERT INTO todo_columns (user_id, name, color, wip_limit, is_done, sort_order) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, name, color, wipLimit, isDone, maxOrder.Int64+1)
+	if err != nil {
+		log.Println("Error adding todo column:", err)
+	}
+
+	http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+}
+
+// UpdateTodoColumnHandler renames a column or changes its color, WIP limit,
+// done flag and position
+func UpdateTodoColumnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	sortOrder, _ := strconv.Atoi(r.FormValue("sort_order"))
+	name, color, wipLimit, isDone, ok := parseTodoColumnForm(r)
+	if !ok {
+		http.Error(w, "列名称不能为空", http.StatusBadRequest)
+		return
+	}
+
+	// 看板至少要保留一个未完成列和一个完成列
+	columns := loadTodoColumns(userID)
+	remaining := map[bool]int{}
+	wasDone, found := false, false
+	for _, c := range columns {
+		if c.ID == id {
+			remaining[isDone == 1]++
+			wasDone, found = c.IsDone, true
+		} else {
+			remaining[c.IsDone]++
+		}
+	}
+	if !found {
+		http.Error(w, "看板列不存在", http.StatusNotFound)
+		return
+	}
+	if remaining[true] == 0 || remaining[false] == 0 {
+		http.Error(w, "看板至少需要一个未完成列和一个完成列", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("开始事务失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE todo_columns SET name = ?, color = ?, wip_limit = ?, is_done = ?, sort_order = ? WHERE id = ? AND user_id = ?",
+		name, color, wipLimit, isDone, sortOrder, id, userID)
+	if err != nil {
+		log.Println("Error updating todo column:", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 改变"完成列"标记时，列里的任务随之完成或重新打开，列表和看板保持一致
+	var changed []int
+	newStatus := "pending"
+	if isDone == 1 {
+		newStatus = "completed"
+	}
+	if wasDone != (isDone == 1) {
+		changed, err = syncTodoColumnStatus(tx, userID, id, newStatus)
+		if err != nil {
+			log.Println("Error syncing todos with column:", err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("提交事务失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	for _, todoID := range changed {
+		afterTodoStatusChange(userID, todoID, 0, newStatus)
+	}
+
+	http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+}
+
+// syncTodoColumnStatus gives the top-level todos shown in a column the status
+// the column now stands for and returns the IDs of the todos that changed.
+// Completed instances of recurring todos that were superseded are left alone,
+// as they are not on the board.
+func syncTodoColumnStatus(tx *sql.Tx, userID, columnID int, status string) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT t.id FROM todos t
+		WHERE t.user_id = ? AND t.column_id = ? AND t.parent_id IS NULL AND t.status <> ?
+		AND NOT (t.series_id IS NOT NULL AND t.status = 'completed'
+			AND EXISTS (SELECT 1 FROM todos n WHERE n.series_id = t.series_id AND n.id > t.id))
+		FOR UPDATE
+	`, userID, columnID, status)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	in, args := bulkTodoArgs(userID, ids)
+	_, err = tx.Exec("UPDATE todos SET status = ?, "+todoCompletedAtSQL+" WHERE user_id = ? AND id IN ("+in+")", append([]interface{}{status}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// DeleteTodoColumnHandler deletes a column; its todos fall back to the first
+// column matching their status
+func DeleteTodoColumnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	// 看板至少要保留一个未完成列和一个完成列
+	remaining := map[bool]int{}
+	for _, c := range loadTodoColumns(userID) {
+		if c.ID != id {
+			remaining[c.IsDone]++
+		}
+	}
+	if remaining[true] == 0 || remaining[false] == 0 {
+		http.Error(w, "看板至少需要一个未完成列和一个完成列", http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.DB.Exec("UPDATE todos SET column_id = NULL WHERE column_id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error detaching todos from column:", err)
+		http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+		return
+	}
+
+	_, err = db.DB.Exec("DELETE FROM todo_columns WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error deleting todo column:", err)
+	}
+
+	http.Redirect(w, r, "/todos/board", http.StatusSeeOther)
+}
+
+// parseTodoColumnForm reads and validates the column form fields
+func parseTodoColumnForm(r *http.Request) (name, color string, wipLimit, isDone int, ok bool) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return "", "", 0, 0, false
+	}
+	if runes := []rune(name); len(runes) > 50 {
+		name = string(runes[:50])
+	}
+	color = r.FormValue("color")
+	if !strings.HasPrefix(color, "#") || len(color) != 7 {
+		color = "#64748B"
+	}
+	wipLimit, _ = strconv.Atoi(r.FormValue("wip_limit"))
+	if wipLimit < 0 {
+		wipLimit = 0
+	}
+	if r.FormValue("is_done") != "" {
+		isDone = 1
+	}
+	return name, color, wipLimit, isDone, true
+}
+
+// loadTodoColumns loads the user's board columns. The default columns are
+// created at startup, on sign-up and after imports (db.CreateUserTodoColumns),
+// so reading never writes.
+func loadTodoColumns(userID int) []models.TodoColumn {
+	rows, err := db.DB.Query("SELECT id, name, color, wip_limit, is_done, sort_order FROM todo_columns WHERE user_id = ? ORDER BY sort_order, id", userID)
+	if err != nil {
+		log.Printf("Error fetching todo columns: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var columns []models.TodoColumn
+	for rows.Next() {
+		var c models.TodoColumn
+		var isDone int
+		if err := rows.Scan(&c.ID, &c.Name, &c.Color, &c.WIPLimit, &isDone, &c.SortOrder); err != nil {
+			log.Printf("Error scanning todo column: %v", err)
+			continue
+		}
+		c.IsDone = isDone == 1
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+// resolveTodoColumn returns the index of the column a todo is shown in. A todo
+// stays in its own column as long as the column agrees with its status (it may
+// have been completed or reopened from the list); otherwise it falls back to
+// the first column for its status. Returns -1 when there is no such column.
+func resolveTodoColumn(columns []models.TodoColumn, columnID int, status string) int {
+	done := status == "completed"
+	fallback := -1
+	for i, c := range columns {
+		if c.IsDone != done {
+			continue
+		}
+		if c.ID == columnID {
+			return i
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+	return fallback
+}
+
+// loadTodoBoard loads the user's columns filled with their top-level todos.
+// Completed instances of recurring todos that were superseded are left out,
+// as on the list page.
+func loadTodoBoard(userID int) []models.TodoColumn {
+	columns := loadTodoColumns(userID)
+
+	rows, err := db.DB.Query(`
+		SELECT t.id, t.content, t.status, t.due_date, t.priority, COALESCE(t.column_id, 0),
+			COALESCE(p.name, ''), COALESCE(p.color, ''), COALESCE(t.recurrence_rule, ''),
+			(SELECT COUNT(*) FROM todos s WHERE s.parent_id = t.id),
+			(SELECT COUNT(*) FROM todos s WHERE s.parent_id = t.id AND s.status = 'completed')
+		FROM todos t
+		LEFT JOIN todo_projects p ON t.project_id = p.id AND p.user_id = t.user_id
+		WHERE t.user_id = ? AND t.parent_id IS NULL
+		AND NOT (t.series_id IS NOT NULL AND t.status = 'completed'
+			AND EXISTS (SELECT 1 FROM todos n WHERE n.series_id = t.series_id AND n.id > t.id))
+		ORDER BY t.board_order, t.priority DESC, t.due_date IS NULL, t.due_date
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching board todos: %v", err)
+		return columns
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.Todo
+		var dueDate sql.NullTime
+		var subtasks int
+		if err := rows.Scan(&t.ID, &t.Content, &t.Status, &dueDate, &t.Priority, &t.ColumnID,
+			&t.ProjectName, &t.ProjectColor, &t.Recurrence, &subtasks, &t.SubtaskDone); err != nil {
+			log.Printf("Error scanning board todo: %v", err)
+			continue
+		}
+		if dueDate.Valid {
+			t.DueDate = dueDate.Time
+		}
+		t.RecurrenceLabel = describeRecurrence(t.Recurrence)
+		if subtasks > 0 {
+			t.Progress = t.SubtaskDone * 100 / subtasks
+		}
+
+		if i := resolveTodoColumn(columns, t.ColumnID, t.Status); i >= 0 {
+			t.ColumnID = columns[i].ID
+			columns[i].Todos = append(columns[i].Todos, t)
+		}
+	}
+
+	for i := range columns {
+		columns[i].OverLimit = columns[i].WIPLimit > 0 && len(columns[i].Todos) > columns[i].WIPLimit
+	}
+	return columns
+}
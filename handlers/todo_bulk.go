@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"goblog/db"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const maxBulkTodos = 500 // 单次批量操作的任务数上限
+
+// bulkTodo is a selected todo as it was before the bulk action
+type bulkTodo struct {
+	ID       int
+	Status   string
+	ParentID int
+}
+
+// BulkTodosHandler completes, reopens, deletes, reschedules or moves many
+// todos at once. Every ID must belong to the user; the whole batch runs in
+// one transaction, so either all todos change or none do.
+func BulkTodosHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Action    string `json:"action"` // complete, reopen, delete, reschedule, move
+		TodoIDs   []int  `json:"todo_ids"`
+		DueDate   string `json:"due_date"`   // reschedule：留空表示清除截止时间
+		ProjectID int    `json:"project_id"` // move：0 表示移出项目
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	ids := uniqueSortedInts(request.TodoIDs)
+	if len(ids) == 0 {
+		http.Error(w, "请至少选择一个任务", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxBulkTodos {
+		http.Error(w, fmt.Sprintf("一次最多操作 %d 个任务", maxBulkTodos), http.StatusBadRequest)
+		return
+	}
+
+	// 先校验参数，再开启事务
+	var dueDate interface{}
+	var projectID interface{}
+	switch request.Action {
+	case "complete", "reopen", "delete":
+	case "reschedule":
+		if request.DueDate != "" {
+			parsed, ok := parseTodoDueDate(request.DueDate)
+			if !ok {
+				http.Error(w, "无法识别的截止时间格式", http.StatusBadRequest)
+				return
+			}
+			if err := validateTodoDueDate(parsed); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			dueDate = parsed
+		}
+	case "move":
+		projectID = ownedTodoProject(userID, request.ProjectID)
+		if request.ProjectID > 0 && projectID == nil {
+			http.Error(w, "项目不存在", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "未知的批量操作", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("开始事务失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	todos, err := lockBulkTodos(tx, userID, ids)
+	if err != nil {
+		log.Printf("Error fetching bulk todos: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	if len(todos) != len(ids) {
+		// 有任务不存在或属于其他用户：整批拒绝
+		http.Error(w, "部分任务不存在或无权操作", http.StatusNotFound)
+		return
+	}
+
+	in, args := bulkTodoArgs(userID, ids)
+	switch request.Action {
+	case "complete":
+		_, err = tx.Exec("UPDATE todos SET status = 'completed', "+todoCompletedAtSQL+" WHERE user_id = ? AND id IN ("+in+")", args...)
+	case "reopen":
+		_, err = tx.Exec("UPDATE todos SET status = 'pending', "+todoCompletedAtSQL+" WHERE user_id = ? AND id IN ("+in+")", args...)
+	case "delete":
+		err = deleteBulkTodos(tx, userID, ids)
+	case "reschedule":
+		_, err = tx.Exec("UPDATE todos SET due_date = ? WHERE user_id = ? AND id IN ("+in+")", append([]interface{}{dueDate}, args...)...)
+	case "move":
+		_, err = tx.Exec("UPDATE todos SET project_id = ? WHERE user_id = ? AND id IN ("+in+")", append([]interface{}{projectID}, args...)...)
+	}
+	if err != nil {
+		log.Printf("Error applying bulk todo action %s: %v", request.Action, err)
+		http.Error(w, "批量操作失败，未做任何修改", http.StatusInternalServerError)
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		log.Printf("提交事务失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
+	// 事务提交后同步子任务、父任务、重复任务和徽章
+	switch request.Action {
+	case "complete", "reopen":
+		newStatus := "completed"
+		if request.Action == "reopen" {
+			newStatus = "pending"
+		}
+		for _, t := range todos {
+			if t.Status != newStatus {
+				afterTodoStatusChange(userID, t.ID, t.ParentID, newStatus)
+			}
+		}
+	case "delete":
+		deleted := make(map[int]bool, len(todos))
+		for _, t := range todos {
+			deleted[t.ID] = true
+		}
+		for _, t := range todos {
+			if t.ParentID > 0 && !deleted[t.ParentID] {
+				rollUpTodoCompletion(userID, t.ParentID)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Todos updated successfully", "action": request.Action, "count": len(todos)})
+}
+
+// lockBulkTodos loads and locks the user's todos among ids
+func lockBulkTodos(tx *sql.Tx, userID int, ids []int) ([]bulkTodo, error) {
+	in, args := bulkTodoArgs(userID, ids)
+	rows, err := tx.Query("SELECT id, status, COALESCE(parent_id, 0) FROM todos WHERE user_id = ? AND id IN ("+in+") FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []bulkTodo
+	for rows.Next() {
+		var t bulkTodo
+		if err := rows.Scan(&t.ID, &t.Status, &t.ParentID); err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+// deleteBulkTodos deletes todos with their subtasks, checkins and sessions
+func deleteBulkTodos(tx *sql.Tx, userID int, ids []int) error {
+	in, args := bulkTodoArgs(userID, ids)
+	// 参数顺序：user_id, ids..., ids...
+	both := append(append([]interface{}{}, args...), args[1:]...)
+	where := "t.user_id = ? AND (t.id IN (" + in + ") OR t.parent_id IN (" + in + "))"
+
+	queries := []string{
+		"DELETE tc FROM todo_checkins tc INNER JOIN todos t ON tc.todo_id = t.id WHERE " + where,
+		"DELETE ts FROM todo_sessions ts INNER JOIN todos t ON ts.todo_id = t.id WHERE " + where,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, both...); err != nil {
+			return err
+		}
+	}
+
+	// 先删子任务，再删任务本身
+	if _, err := tx.Exec("DELETE FROM todos WHERE user_id = ? AND parent_id IN ("+in+")", args...); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM todos WHERE user_id = ? AND id IN ("+in+")", args...)
+	return err
+}
+
+// bulkTodoArgs returns the IN placeholders for ids and the query arguments
+// starting with userID
+func bulkTodoArgs(userID int, ids []int) (string, []interface{}) {
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, userID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","), args
+}
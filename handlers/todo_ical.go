@@ -0,0 +1,625 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	icalProductID    = "-//GoBlog//Todos//ZH"
+	icalEventLength  = 30 * time.Minute // 有具体时间的任务在日历中占 30 分钟
+	maxICalImportLen = 5 << 20          // 导入文件最大 5MB
+	maxICalImport    = 1000             // 单次最多导入的条目数
+)
+
+// TodoICalHandler shows the user's calendar subscription link and the .ics
+// import form
+func TodoICalHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user session
+	session, _ := auth.ValidateSession(r)
+
+	token, err := userCalendarToken(userID, false)
+	if err != nil {
+		log.Printf("Error creating calendar token: %v", err)
+	}
+
+	query := r.URL.Query()
+	imported, _ := strconv.Atoi(query.Get("imported"))
+	skipped, _ := strconv.Atoi(query.Get("skipped"))
+
+	feedURL := ""
+	if token != "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		feedURL = scheme + "://" + r.Host + "/ical/" + token + ".ics"
+	}
+
+	data := struct {
+		ActivePage  string
+		FeedURL     string
+		WebcalURL   template.URL // webcal:// 不在模板默认允许的协议中
+		Imported    int
+		Skipped     int
+		ShowResult  bool
+		ImportError string
+		User        *auth.Session
+		IsLoggedIn  bool
+	}{
+		ActivePage:  "todos",
+		FeedURL:     feedURL,
+		WebcalURL:   template.URL(strings.Replace(strings.Replace(feedURL, "https://", "webcal://", 1), "http://", "webcal://", 1)),
+		Imported:    imported,
+		Skipped:     skipped,
+		ShowResult:  query.Get("imported") != "",
+		ImportError: query.Get("error"),
+		User:        session,
+		IsLoggedIn:  session != nil,
+	}
+
+	renderTemplate(w, "todo_ical.html", data)
+}
+
+// ResetTodoICalTokenHandler replaces the subscription token; the old link
+// stops working immediately
+func ResetTodoICalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos/ical", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := userCalendarToken(userID, true); err != nil {
+		log.Printf("Error resetting calendar token: %v", err)
+	}
+
+	http.Redirect(w, r, "/todos/ical", http.StatusSeeOther)
+}
+
+// TodoICalFeedHandler serves /ical/{token}.ics. It needs no session: calendar
+// clients authenticate with the token in the URL.
+func TodoICalFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/ical/"), ".ics")
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var userID int
+	var username string
+	err := db.DB.QueryRow("SELECT id, username FROM users WHERE calendar_token = ?", token).Scan(&userID, &username)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, content, status, due_date, priority, COALESCE(recurrence_rule, ''),
+			COALESCE(series_id, id), COALESCE(tags, ''), created_at, completed_at
+		FROM todos
+		WHERE user_id = ? AND due_date IS NOT NULL
+		ORDER BY due_date
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching todos for calendar feed: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	now := time.Now()
+	writeICalLine(&b, "BEGIN:VCALENDAR")
+	writeICalLine(&b, "VERSION:2.0")
+	writeICalLine(&b, "PRODID:"+icalProductID)
+	writeICalLine(&b, "CALSCALE:GREGORIAN")
+	writeICalLine(&b, "METHOD:PUBLISH")
+	writeICalLine(&b, "X-WR-CALNAME:"+icalEscape(username+" 的待办"))
+	for rows.Next() {
+		var id, priority, seriesID int
+		var content, status, rule, tags string
+		var due, createdAt time.Time
+		var completedAt sql.NullTime
+		if err := rows.Scan(&id, &content, &status, &due, &priority, &rule, &seriesID, &tags, &createdAt, &completedAt); err != nil {
+			log.Printf("Error scanning todo for calendar feed: %v", err)
+			continue
+		}
+
+		// 重复任务只有当前未完成的实例带 RRULE，并使用整个系列共享的 UID，
+		// 这样完成后生成的下一个实例会更新同一个日历事件
+		uid := fmt.Sprintf("todo-%d@goblog", id)
+		rrule := ""
+		if rule != "" && status != "completed" {
+			if rrule = icalRRule(rule); rrule != "" {
+				uid = fmt.Sprintf("todo-series-%d@goblog", seriesID)
+			}
+		}
+
+		writeICalLine(&b, "BEGIN:VEVENT")
+		writeICalLine(&b, "UID:"+uid)
+		writeICalLine(&b, "DTSTAMP:"+icalUTC(now))
+		writeICalLine(&b, "CREATED:"+icalUTC(createdAt))
+		if due.Hour() == 0 && due.Minute() == 0 {
+			// 零点视为只有日期的全天事件
+			writeICalLine(&b, "DTSTART;VALUE=DATE:"+due.Format("20060102"))
+			writeICalLine(&b, "DTEND;VALUE=DATE:"+due.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			writeICalLine(&b, "DTSTART:"+icalUTC(due))
+			writeICalLine(&b, "DTEND:"+icalUTC(due.Add(icalEventLength)))
+		}
+		summary := content
+		if status == "completed" {
+			summary = "✓ " + summary
+		}
+		writeICalLine(&b, "SUMMARY:"+icalEscape(summary))
+		if rrule != "" {
+			writeICalLine(&b, "RRULE:"+rrule)
+		}
+		if p := icalPriority(priority); p > 0 {
+			writeICalLine(&b, "PRIORITY:"+strconv.Itoa(p))
+		}
+		if tags != "" {
+			var escaped []string
+			for _, tag := range strings.Split(tags, ",") {
+				escaped = append(escaped, icalEscape(tag))
+			}
+			writeICalLine(&b, "CATEGORIES:"+strings.Join(escaped, ","))
+		}
+		if completedAt.Valid {
+			writeICalLine(&b, "X-GOBLOG-COMPLETED:"+icalUTC(completedAt.Time))
+		}
+		writeICalLine(&b, "END:VEVENT")
+	}
+	writeICalLine(&b, "END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="todos.ics"`)
+	io.WriteString(w, b.String())
+}
+
+// ImportTodoICalHandler creates todos from the VTODO and VEVENT entries of an
+// uploaded .ics file. Entries whose UID was imported before are skipped.
+func ImportTodoICalHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos/ical", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fail := func(message string) {
+		http.Redirect(w, r, "/todos/ical?imported=0&error="+url.QueryEscape(message), http.StatusSeeOther)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxICalImportLen+1<<20)
+	if err := r.ParseMultipartForm(maxICalImportLen); err != nil {
+		fail("文件过大")
+		return
+	}
+	file, _, err := r.FormFile("ics_file")
+	if err != nil {
+		fail("获取文件失败")
+		return
+	}
+	defer file.Close()
+
+	items, err := parseICal(io.LimitReader(file, maxICalImportLen))
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if len(items) > maxICalImport {
+		fail(fmt.Sprintf("一次最多导入 %d 条", maxICalImport))
+		return
+	}
+
+	imported, skipped := 0, 0
+	for _, item := range items {
+		if item.Summary == "" {
+			skipped++
+			continue
+		}
+		// ical_uid 最多存 255 个字符，查重时也用截断后的值
+		uid := item.UID
+		if runes := []rune(uid); len(runes) > 255 {
+			uid = string(runes[:255])
+		}
+		if uid != "" {
+			var count int
+			db.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE user_id = ? AND ical_uid = ?", userID, uid).Scan(&count)
+			if count > 0 || isOwnICalUID(userID, item.UID) {
+				skipped++
+				continue
+			}
+		}
+
+		var due interface{}
+		if !item.Due.IsZero() {
+			due = item.Due
+		}
+		status := "pending"
+		var completedAt interface{}
+		if item.Completed {
+			status = "completed"
+			completedAt = time.Now()
+			if !item.CompletedAt.IsZero() {
+				completedAt = item.CompletedAt
+			}
+		}
+		tags := strings.Join(item.Tags, ",")
+		if runes := []rune(tags); len(runes) > 255 {
+			tags = string(runes[:255])
+		}
+
+		_, err := db.DB.Exec(
+			"INSERT INTO todos (user_id, content, status, due_date, priority, recurrence_rule, tags, completed_at, ical_uid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			userID, item.Summary, status, due, item.Priority, item.Recurrence, tags, completedAt, uid,
+		)
+		if err != nil {
+			log.Printf("Error importing todo from ics: %v", err)
+			skipped++
+			continue
+		}
+		imported++
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/todos/ical?imported=%d&skipped=%d", imported, skipped), http.StatusSeeOther)
+}
+
+// isOwnICalUID reports whether uid comes from the user's own feed, so
+// importing one's own subscription doesn't duplicate every todo
+func isOwnICalUID(userID int, uid string) bool {
+	var id int
+	var column string
+	if _, err := fmt.Sscanf(uid, "todo-series-%d@goblog", &id); err == nil {
+		column = "COALESCE(series_id, id)"
+	} else if _, err := fmt.Sscanf(uid, "todo-%d@goblog", &id); err == nil {
+		column = "id"
+	} else {
+		return false
+	}
+	var count int
+	db.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE user_id = ? AND "+column+" = ?", userID, id).Scan(&count)
+	return count > 0
+}
+
+// userCalendarToken returns the user's feed token, creating one when missing
+// or when reset is set
+func userCalendarToken(userID int, reset bool) (string, error) {
+	var token sql.NullString
+	if !reset {
+		if err := db.DB.QueryRow("SELECT calendar_token FROM users WHERE id = ?", userID).Scan(&token); err != nil {
+			return "", err
+		}
+		if token.String != "" {
+			return token.String, nil
+		}
+	}
+
+	newToken, err := auth.GenerateToken(24)
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.DB.Exec("UPDATE users SET calendar_token = ? WHERE id = ?", newToken, userID); err != nil {
+		return "", err
+	}
+	return newToken, nil
+}
+
+// icalItem is a VTODO or VEVENT read from an .ics file
+type icalItem struct {
+	UID         string
+	Summary     string
+	Due         time.Time
+	Priority    int // 已换算为 models.TodoPriority*
+	Recurrence  string
+	Tags        []string
+	Completed   bool
+	CompletedAt time.Time
+}
+
+// parseICal reads the VTODO and VEVENT components of an iCalendar stream.
+// VTODOs use DUE (falling back to DTSTART), VEVENTs use DTSTART.
+func parseICal(r io.Reader) ([]icalItem, error) {
+	// 先展开折行：以空格或制表符开头的行接在上一行后面
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxICalImportLen)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取文件失败")
+	}
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("不是有效的 iCalendar (.ics) 文件")
+	}
+
+	var items []icalItem
+	var current *icalItem
+	var component string
+	var start, due time.Time
+	var rrule string
+	for _, line := range lines {
+		name, params, value := splitICalLine(line)
+		switch {
+		case name == "BEGIN" && (value == "VTODO" || value == "VEVENT"):
+			current = &icalItem{}
+			component = value
+			start, due, rrule = time.Time{}, time.Time{}, ""
+			continue
+		case name == "END" && current != nil && value == component:
+			current.Due = due
+			if current.Due.IsZero() {
+				current.Due = start
+			}
+			current.Recurrence = icalRuleToRecurrence(rrule, current.Due)
+			items = append(items, *current)
+			current = nil
+			continue
+		case current == nil:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			current.UID = value
+		case "SUMMARY":
+			current.Summary = strings.TrimSpace(icalUnescape(value))
+		case "DTSTART":
+			start = parseICalTime(value, params)
+		case "DUE":
+			due = parseICalTime(value, params)
+		case "RRULE":
+			rrule = value
+		case "PRIORITY":
+			// RFC 5545：1-4 高，5 中，6-9 低，0 未定义
+			if p, err := strconv.Atoi(value); err == nil {
+				switch {
+				case p >= 1 && p <= 4:
+					current.Priority = models.TodoPriorityHigh
+				case p == 5:
+					current.Priority = models.TodoPriorityMedium
+				case p >= 6 && p <= 9:
+					current.Priority = models.TodoPriorityLow
+				}
+			}
+		case "CATEGORIES":
+			for _, tag := range splitICalList(value) {
+				tag = strings.TrimSpace(icalUnescape(tag))
+				if tag != "" && !containsString(current.Tags, tag) {
+					current.Tags = append(current.Tags, tag)
+				}
+			}
+		case "STATUS":
+			current.Completed = strings.EqualFold(value, "COMPLETED")
+		case "COMPLETED":
+			current.Completed = true
+			current.CompletedAt = parseICalTime(value, params)
+		}
+	}
+	return items, nil
+}
+
+// splitICalLine splits "DTSTART;TZID=Asia/Shanghai:20261018T090000" into its
+// upper-cased name, parameters and value
+func splitICalLine(line string) (string, map[string]string, string) {
+	head, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", nil, ""
+	}
+	parts := strings.Split(head, ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	name := strings.ToUpper(parts[0])
+	if name == "BEGIN" || name == "END" {
+		value = strings.ToUpper(strings.TrimSpace(value))
+	}
+	return name, params, value
+}
+
+// parseICalTime parses UTC ("...Z"), local or TZID date-times and dates;
+// it returns the zero time for values it doesn't understand
+func parseICalTime(value string, params map[string]string) time.Time {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t.In(time.Local)
+	}
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	for _, layout := range []string{"20060102T150405", "20060102T1504", "20060102"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.In(time.Local)
+		}
+	}
+	return time.Time{}
+}
+
+// icalRuleToRecurrence converts the RRULEs our recurrence rules can express;
+// anything else (intervals, counts, yearly...) imports as a one-off todo
+func icalRuleToRecurrence(rrule string, due time.Time) string {
+	if rrule == "" {
+		return ""
+	}
+	parts := make(map[string]string)
+	for _, p := range strings.Split(rrule, ";") {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			parts[strings.ToUpper(k)] = strings.ToUpper(v)
+		}
+	}
+	if parts["INTERVAL"] != "" && parts["INTERVAL"] != "1" {
+		return ""
+	}
+	if parts["COUNT"] != "" || parts["UNTIL"] != "" {
+		return ""
+	}
+
+	switch parts["FREQ"] {
+	case "DAILY":
+		return recurrenceDaily
+	case "MONTHLY":
+		if parts["BYDAY"] != "" {
+			return ""
+		}
+		return recurrenceMonthly
+	case "WEEKLY":
+		var days []int
+		if parts["BYDAY"] == "" {
+			if due.IsZero() {
+				return ""
+			}
+			days = []int{int(due.Weekday())}
+		}
+		for _, d := range strings.Split(parts["BYDAY"], ",") {
+			if i := indexOf(icalWeekdays, d); i >= 0 {
+				days = append(days, i)
+			} else if d != "" {
+				return ""
+			}
+		}
+		days = uniqueSortedInts(days)
+		names := make([]string, len(days))
+		for i, d := range days {
+			names[i] = strconv.Itoa(d)
+		}
+		return recurrenceWeekly + ":" + strings.Join(names, ",")
+	}
+	return ""
+}
+
+// icalWeekdays are the RRULE BYDAY names, indexed like time.Weekday
+var icalWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// icalRRule converts a recurrence rule to an RRULE; "after:N" depends on the
+// completion date and has no RRULE equivalent
+func icalRRule(rule string) string {
+	kind, arg, _ := strings.Cut(rule, ":")
+	switch kind {
+	case recurrenceDaily:
+		return "FREQ=DAILY"
+	case recurrenceMonthly:
+		return "FREQ=MONTHLY"
+	case recurrenceWeekly:
+		var days []string
+		for _, d := range weeklyDays(arg) {
+			days = append(days, icalWeekdays[d])
+		}
+		if len(days) == 0 {
+			return ""
+		}
+		return "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ",")
+	}
+	return ""
+}
+
+// icalPriority maps a todo priority to the RFC 5545 scale (1 highest)
+func icalPriority(priority int) int {
+	switch priority {
+	case models.TodoPriorityHigh:
+		return 1
+	case models.TodoPriorityMedium:
+		return 5
+	case models.TodoPriorityLow:
+		return 9
+	}
+	return 0
+}
+
+func icalUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icalEscape(s string) string {
+	return icalEscaper.Replace(s)
+}
+
+var icalUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func icalUnescape(s string) string {
+	return icalUnescaper.Replace(s)
+}
+
+// splitICalList splits a comma separated value on unescaped commas only, so
+// "a\,b" stays one item; the items are still escaped
+func splitICalList(s string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // 跳过被转义的字符
+		case ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// writeICalLine writes a content line, folded at 75 octets without splitting
+// UTF-8 characters
+func writeICalLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Start(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // 续行开头的空格也算一个字节
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isUTF8Start(c byte) bool {
+	return c&0xC0 != 0x80
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"database/sql"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// todoSortOrders maps the sort options of the todo page to ORDER BY clauses.
+// Pending todos always come before completed ones.
+var todoSortOrders = map[string]string{
+	"default":  "t.status DESC, t.due_date ASC",
+	"due":      "t.status DESC, t.due_date IS NULL, t.due_date ASC",
+	"priority": "t.status DESC, t.priority DESC, t.due_date IS NULL, t.due_date ASC",
+	"created":  "t.status DESC, t.created_at DESC",
+	"project":  "t.status DESC, p.sort_order IS NULL, p.sort_order, p.id, t.due_date ASC",
+}
+
+// todoPriorityNames maps the priority names used in forms to priority levels
+var todoPriorityNames = map[string]int{
+	"none":   models.TodoPriorityNone,
+	"low":    models.TodoPriorityLow,
+	"medium": models.TodoPriorityMedium,
+	"high":   models.TodoPriorityHigh,
+}
+
+// AddTodoProjectHandler creates a new todo project (list)
+func AddTodoProjectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	color := r.FormValue("color")
+	if name == "" {
+		http.Error(w, "项目名称不能为空", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(color, "#") || len(color) != 7 {
+		color = "#3B82F6"
+	}
+
+	var maxOrder sql.NullInt64
+	db.DB.QueryRow("SELECT MAX(sort_order) FROM todo_projects WHERE user_id = ?", userID).Scan(&maxOrder)
+
+	_, err := db.DB.Exec("INSERT INTO todo_projects (user_id, name, color, sort_order) VALUES (?, ?, ?, ?)", userID, name, color, maxOrder.Int64+1)
+	if err != nil {
+		log.Println("Error adding todo project:", err)
+	}
+
+	http.Redirect(w, r, "/todos", http.StatusSeeOther)
+}
+
+// DeleteTodoProjectHandler deletes a project; its todos are kept without a project
+func DeleteTodoProjectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	_, err := db.DB.Exec("UPDATE todos SET project_id = NULL WHERE project_id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error detaching todos from project:", err)
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	_, err = db.DB.Exec("DELETE FROM todo_projects WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Println("Error deleting todo project:", err)
+	}
+
+	http.Redirect(w, r, "/todos", http.StatusSeeOther)
+}
+
+// loadTodoProjects loads the user's projects with their pending todo counts
+func loadTodoProjects(userID int) []models.TodoProject {
+	rows, err := db.DB.Query(`
+		SELECT p.id, p.name, p.color, p.sort_order, COUNT(t.id)
+		FROM todo_projects p
+		LEFT JOIN todos t ON t.project_id = p.id AND t.user_id = p.user_id AND t.status <> 'completed'
+		WHERE p.user_id = ?
+		GROUP BY p.id, p.name, p.color, p.sort_order
+		ORDER BY p.sort_order, p.id
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching todo projects: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var projects []models.TodoProject
+	for rows.Next() {
+		var p models.TodoProject
+		if err := rows.Scan(&p.ID, &p.Name, &p.Color, &p.SortOrder, &p.PendingCount); err != nil {
+			log.Printf("Error scanning todo project: %v", err)
+			continue
+		}
+		projects = append(projects, p)
+	}
+	return projects
+}
+
+// parseTodoPriority accepts a priority name ("high") or level ("3")
+func parseTodoPriority(value string) int {
+	if level, ok := todoPriorityNames[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return level
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil || level < models.TodoPriorityNone || level > models.TodoPriorityHigh {
+		return models.TodoPriorityNone
+	}
+	return level
+}
+
+// ownedTodoProject returns projectID if it belongs to the user, or nil for "no project"
+func ownedTodoProject(userID, projectID int) interface{} {
+	if projectID <= 0 {
+		return nil
+	}
+	var count int
+	db.DB.QueryRow("SELECT COUNT(*) FROM todo_projects WHERE id = ? AND user_id = ?", projectID, userID).Scan(&count)
+	if count == 0 {
+		return nil
+	}
+	return projectID
+}
+
+// rollUpTodoCompletion completes a parent todo once all its subtasks are done,
+// and reopens it when any subtask is pending again.
+func rollUpTodoCompletion(userID, parentID int) {
+	var total, done int
+	err := db.DB.QueryRow("SELECT COUNT(*), COALESCE(SUM(status = 'completed'), 0) FROM todos WHERE parent_id = ? AND user_id = ?", parentID, userID).Scan(&total, &done)
+	if err != nil || total == 0 {
+		return
+	}
+
+	status := "pending"
+	if done == total {
+		status = "completed"
+	}
+	_, err = db.DB.Exec("UPDATE todos SET status = ?, "+todoCompletedAtSQL+" WHERE id = ? AND user_id = ?", status, parentID, userID)
+	if err != nil {
+		log.Println("Error rolling up todo completion:", err)
+	}
+}
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"goblog/models"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quickAddResult is what parseQuickAdd extracts from a quick-add phrase such as
+// "明天下午3点 交房租 !high #家务" or "every Monday 9am standup".
+type quickAddResult struct {
+	Content         string    `json:"content"`
+	DueDate         time.Time `json:"-"`
+	HasDue          bool      `json:"has_due"`
+	Due             string    `json:"due_date"` // datetime-local 格式，可直接填入表单
+	Priority        int       `json:"priority"`
+	Tags            []string  `json:"tags"`
+	Recurrence      string    `json:"recurrence"`
+	RecurrenceLabel string    `json:"recurrence_label"`
+	Warning         string    `json:"warning,omitempty"`
+}
+
+// quickEnglishDays matches English weekday names and their abbreviations
+const quickEnglishDays = `(?:mon(?:day)?|tue(?:s|sday)?|wed(?:nesday)?|thu(?:r|rs|rsday)?|fri(?:day)?|sat(?:urday)?|sun(?:day)?)`
+
+// quickAddDefaultHour 只有日期没有时间时的默认截止时间（当天 23:59）
+const quickAddDefaultHour, quickAddDefaultMinute = 23, 59
+
+var (
+	quickTagPattern      = regexp.MustCompile(`(?:^|\s)[#＃]([^\s#＃!！]+)`)
+	quickPriorityPattern = regexp.MustCompile(`(?:^|\s)[!！]([^\s!！]+)`)
+
+	// 重复规则
+	quickWorkdayPattern      = regexp.MustCompile(`每个?工作日|(?i)\bevery\s+weekdays?\b`)
+	quickWeeklyZhPattern     = regexp.MustCompile(`每(?:周|星期|礼拜)([一二三四五六日天、,，和]+)`)
+	quickWeeklyEnPattern     = regexp.MustCompile(`(?i)\bevery\s+(` + quickEnglishDays + `(?:\s*(?:,|and|&)\s*` + quickEnglishDays + `)*)\b`)
+	quickDailyPattern        = regexp.MustCompile(`每(?:天|日)|(?i)\b(?:every\s*day|daily)\b`)
+	quickMonthlyPattern      = regexp.MustCompile(`每个?月|(?i)\b(?:every\s+month|monthly)\b`)
+	quickIntervalPattern     = regexp.MustCompile(`每隔?(\d+)天|(?i)\bevery\s+(\d+)\s+days?\b`)
+	quickWeeklyPlainPattern  = regexp.MustCompile(`每(?:周|星期|礼拜)|(?i)\b(?:every\s+week|weekly)\b`)
+	quickEnglishDayPattern   = regexp.MustCompile(`(?i)^` + quickEnglishDays + `$`)
+	quickWordPattern         = regexp.MustCompile(`[a-zA-Z]+`)
+	quickEnglishWeekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+	// 日期
+	quickFullDatePattern  = regexp.MustCompile(`(\d{4})[-/.年](\d{1,2})[-/.月](\d{1,2})[日号]?`)
+	quickMonthDayPattern  = regexp.MustCompile(`(\d{1,2})月(\d{1,2})[日号]`)
+	quickRelDayZhPattern  = regexp.MustCompile(`大后天|后天|明天|明早|明晚|今天|今晚`)
+	quickDaysLaterPattern = regexp.MustCompile(`(\d+)天后|(?i)\bin\s+(\d+)\s+days?\b`)
+	quickWeekdayZhPattern = regexp.MustCompile(`(下下|下|这|本)?(?:周|星期|礼拜)([一二三四五六日天])`)
+	quickRelDayEnPattern  = regexp.MustCompile(`(?i)\b(today|tonight|tomorrow|tmr)\b`)
+	quickWeekdayEnPattern = regexp.MustCompile(`(?i)\b(?:on\s+)?(next\s+)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+
+	// 时间
+	quickTimeZhPattern = regexp.MustCompile(`(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上)?\s*(\d{1,2}|[零一二两三四五六七八九十]{1,3})(?:[:：](\d{2})|[点時时](半|(\d{1,2})分?)?)`)
+	quickTimeEnPattern = regexp.MustCompile(`(?i)\b(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)\b|\bat\s+(\d{1,2}):(\d{2})\b`)
+	quickSpacePattern  = regexp.MustCompile(`\s+`)
+)
+
+var quickPriorityNames = map[string]int{
+	"高": models.TodoPriorityHigh, "h": models.TodoPriorityHigh, "high": models.TodoPriorityHigh, "3": models.TodoPriorityHigh,
+	"中": models.TodoPriorityMedium, "m": models.TodoPriorityMedium, "med": models.TodoPriorityMedium, "medium": models.TodoPriorityMedium, "2": models.TodoPriorityMedium,
+	"低": models.TodoPriorityLow, "l": models.TodoPriorityLow, "low": models.TodoPriorityLow, "1": models.TodoPriorityLow,
+}
+
+var quickZhWeekdays = map[string]int{"日": 0, "天": 0, "一": 1, "二": 2, "三": 3, "四": 4, "五": 5, "六": 6}
+
+// ParseTodoQuickAddHandler previews how a quick-add phrase will be saved
+func ParseTodoQuickAddHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserIDFromContext(r); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result := parseQuickAdd(r.FormValue("text"), time.Now())
+	if result.HasDue && result.DueDate.Before(time.Now()) {
+		result.Warning = "截止时间已过，请调整"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// parseQuickAdd extracts due date, priority, tags and recurrence from a todo's
+// content, returning the remaining text as the content. Unrecognised text is
+// left untouched.
+func parseQuickAdd(input string, now time.Time) quickAddResult {
+	var res quickAddResult
+	text := " " + input + " "
+
+	// 标签和优先级
+	text = quickTagPattern.ReplaceAllStringFunc(text, func(m string) string {
+		tag := quickTagPattern.FindStringSubmatch(m)[1]
+		if !containsString(res.Tags, tag) {
+			res.Tags = append(res.Tags, tag)
+		}
+		return " "
+	})
+	text = quickPriorityPattern.ReplaceAllStringFunc(text, func(m string) string {
+		level, ok := quickPriorityNames[strings.ToLower(quickPriorityPattern.FindStringSubmatch(m)[1])]
+		if !ok {
+			return m
+		}
+		res.Priority = level
+		return " "
+	})
+
+	// 重复规则；"每周"不带星期几时，按截止日期的星期几重复
+	var weekly []int
+	plainWeekly := false
+	if quickWorkdayPattern.MatchString(text) {
+		text = quickWorkdayPattern.ReplaceAllString(text, " ")
+		weekly = []int{1, 2, 3, 4, 5}
+	} else if m := quickWeeklyZhPattern.FindStringSubmatch(text); m != nil {
+		text = strings.Replace(text, m[0], " ", 1)
+		for _, ch := range m[1] {
+			if d, ok := quickZhWeekdays[string(ch)]; ok {
+				weekly = append(weekly, d)
+			}
+		}
+	} else if m := quickWeeklyEnPattern.FindStringSubmatch(text); m != nil {
+		text = strings.Replace(text, m[0], " ", 1)
+		for _, word := range quickWordPattern.FindAllString(m[1], -1) {
+			if quickEnglishDayPattern.MatchString(word) {
+				weekly = append(weekly, indexOf(quickEnglishWeekdayNames, strings.ToLower(word[:3])))
+			}
+		}
+	} else if m := quickIntervalPattern.FindStringSubmatch(text); m != nil {
+		text = strings.Replace(text, m[0], " ", 1)
+		n, _ := strconv.Atoi(m[1] + m[2])
+		if n >= 1 && n <= maxRecurrenceAfterDays {
+			res.Recurrence = fmt.Sprintf("%s:%d", recurrenceAfter, n)
+		}
+	} else if quickDailyPattern.MatchString(text) {
+		text = quickDailyPattern.ReplaceAllString(text, " ")
+		res.Recurrence = recurrenceDaily
+	} else if quickMonthlyPattern.MatchString(text) {
+		text = quickMonthlyPattern.ReplaceAllString(text, " ")
+		res.Recurrence = recurrenceMonthly
+	} else if quickWeeklyPlainPattern.MatchString(text) {
+		text = quickWeeklyPlainPattern.ReplaceAllString(text, " ")
+		plainWeekly = true
+	}
+
+	// 日期
+	var date time.Time
+	hasDate := false
+	defaultHour, defaultMinute := quickAddDefaultHour, quickAddDefaultMinute
+	evening := false // "今晚8点"里的 8 点是晚上 8 点
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if m := quickFullDatePattern.FindStringSubmatch(text); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		if validDate(y, mo, d) {
+			text = removeQuickDate(text, m[0])
+			date, hasDate = time.Date(y, time.Month(mo), d, 0, 0, 0, 0, now.Location()), true
+		}
+	} else if m := quickMonthDayPattern.FindStringSubmatch(text); m != nil {
+		mo, _ := strconv.Atoi(m[1])
+		d, _ := strconv.Atoi(m[2])
+		if validDate(now.Year(), mo, d) {
+			text = removeQuickDate(text, m[0])
+			date, hasDate = time.Date(now.Year(), time.Month(mo), d, 0, 0, 0, 0, now.Location()), true
+			if date.Before(today) {
+				date = date.AddDate(1, 0, 0)
+			}
+		}
+	} else if m := quickRelDayZhPattern.FindString(text); m != "" {
+		text = removeQuickDate(text, m)
+		offsets := map[string]int{"今天": 0, "今晚": 0, "明天": 1, "明早": 1, "明晚": 1, "后天": 2, "大后天": 3}
+		date, hasDate = today.AddDate(0, 0, offsets[m]), true
+		switch m {
+		case "今晚", "明晚":
+			defaultHour, defaultMinute = 20, 0
+			evening = true
+		case "明早":
+			defaultHour, defaultMinute = 8, 0
+		}
+	} else if m := quickDaysLaterPattern.FindStringSubmatch(text); m != nil {
+		text = strings.Replace(text, m[0], " ", 1)
+		n, _ := strconv.Atoi(m[1] + m[2])
+		date, hasDate = today.AddDate(0, 0, n), true
+	} else if m := quickWeekdayZhPattern.FindStringSubmatch(text); m != nil {
+		text = removeQuickDate(text, m[0])
+		weeks := map[string]int{"": -1, "这": 0, "本": 0, "下": 1, "下下": 2}[m[1]]
+		date, hasDate = weekdayDate(today, quickZhWeekdays[m[2]], weeks), true
+	} else if m := quickRelDayEnPattern.FindStringSubmatch(text); m != nil {
+		text = strings.Replace(text, m[0], " ", 1)
+		switch strings.ToLower(m[1]) {
+		case "today":
+			date = today
+		case "tonight":
+			date = today
+			defaultHour, defaultMinute = 20, 0
+			evening = true
+		default:
+			date = today.AddDate(0, 0, 1)
+		}
+		hasDate = true
+	} else if m := quickWeekdayEnPattern.FindStringSubmatch(text); m != nil {
+		text = strings.Replace(text, m[0], " ", 1)
+		weeks := -1
+		if m[1] != "" {
+			weeks = 1
+		}
+		day := indexOf(quickEnglishWeekdayNames, strings.ToLower(m[2][:3]))
+		date, hasDate = weekdayDate(today, day, weeks), true
+	}
+
+	// 时间
+	hour, minute, hasTime := 0, 0, false
+	if m := quickTimeEnPattern.FindStringSubmatch(text); m != nil {
+		if m[1] != "" {
+			hour, _ = strconv.Atoi(m[1])
+			minute, _ = strconv.Atoi(m[2])
+			switch strings.ToLower(m[3]) {
+			case "pm":
+				if hour < 12 {
+					hour += 12
+				}
+			case "am":
+				if hour == 12 {
+					hour = 0
+				}
+			}
+		} else {
+			hour, _ = strconv.Atoi(m[4])
+			minute, _ = strconv.Atoi(m[5])
+			if evening && hour < 12 {
+				hour += 12
+			}
+		}
+		if hour < 24 && minute < 60 {
+			text = strings.Replace(text, m[0], " ", 1)
+			hasTime = true
+		}
+	} else if m := quickTimeZhPattern.FindStringSubmatch(text); m != nil {
+		hour = parseZhNumber(m[2])
+		switch {
+		case m[3] != "":
+			minute, _ = strconv.Atoi(m[3])
+		case m[4] == "半":
+			minute = 30
+		case m[5] != "":
+			minute, _ = strconv.Atoi(m[5])
+		}
+		switch m[1] {
+		case "下午", "傍晚", "晚上":
+			if hour < 12 {
+				hour += 12
+			}
+		case "中午":
+			if hour < 11 {
+				hour += 12
+			}
+		case "凌晨":
+			if hour == 12 {
+				hour = 0
+			}
+		case "":
+			if evening && hour < 12 {
+				hour += 12
+			}
+		}
+		// "买2点心"、"快一点"之类的说法不算时间：单独的钟点需要"下午"等前缀、
+		// 日期或明确的分钟（"10:30"、"3点20分"）
+		plausible := m[1] != "" || hasDate || m[3] != "" || m[5] != ""
+		if plausible && hour >= 0 && hour < 24 && minute < 60 {
+			text = strings.Replace(text, m[0], " ", 1)
+			hasTime = true
+		}
+	}
+
+	// 组合截止时间
+	if !hasTime {
+		hour, minute = defaultHour, defaultMinute
+	}
+	switch {
+	case hasDate:
+		res.DueDate, res.HasDue = time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, now.Location()), true
+	case len(weekly) > 0:
+		// 每周重复的第一次：从今天起第一个符合的日子
+		sort.Ints(weekly)
+		for i := 0; i < 8; i++ {
+			day := today.AddDate(0, 0, i)
+			due := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+			if containsInt(weekly, int(day.Weekday())) && due.After(now) {
+				res.DueDate, res.HasDue = due, true
+				break
+			}
+		}
+	case hasTime:
+		// 只有时间：今天还没到就是今天，否则明天
+		res.DueDate, res.HasDue = time.Date(today.Year(), today.Month(), today.Day(), hour, minute, 0, 0, now.Location()), true
+		if !res.DueDate.After(now) {
+			res.DueDate = res.DueDate.AddDate(0, 0, 1)
+		}
+	}
+
+	if plainWeekly {
+		base := now
+		if res.HasDue {
+			base = res.DueDate
+		}
+		weekly = []int{int(base.Weekday())}
+	}
+	if len(weekly) > 0 {
+		weekly = uniqueSortedInts(weekly)
+		parts := make([]string, len(weekly))
+		for i, d := range weekly {
+			parts[i] = strconv.Itoa(d)
+		}
+		res.Recurrence = recurrenceWeekly + ":" + strings.Join(parts, ",")
+	}
+
+	res.RecurrenceLabel = describeRecurrence(res.Recurrence)
+	if res.HasDue {
+		res.Due = res.DueDate.Format("2006-01-02T15:04")
+	}
+	res.Content = strings.TrimSpace(quickSpacePattern.ReplaceAllString(text, " "))
+	if res.Content == "" {
+		// 整句都是日期等信息时保留原文
+		res.Content = strings.TrimSpace(input)
+	}
+	return res
+}
+
+// removeQuickDate removes a matched Chinese date together with a trailing
+// "前"/"之前" ("周五前 交报告")
+func removeQuickDate(text, match string) string {
+	i := strings.Index(text, match)
+	if i < 0 {
+		return text
+	}
+	rest := text[i+len(match):]
+	for _, suffix := range []string{"之前", "前"} {
+		if strings.HasPrefix(rest, suffix) {
+			rest = rest[len(suffix):]
+			break
+		}
+	}
+	return text[:i] + " " + rest
+}
+
+// weekdayDate returns the date of a weekday. weeks < 0 means the next such day
+// from today on (today included); otherwise the day in the week that is weeks
+// weeks after the current one (weeks start on Monday).
+func weekdayDate(today time.Time, weekday, weeks int) time.Time {
+	if weeks < 0 {
+		diff := (weekday - int(today.Weekday()) + 7) % 7
+		return today.AddDate(0, 0, diff)
+	}
+	// 周一为一周的第一天
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	return monday.AddDate(0, 0, weeks*7+(weekday+6)%7)
+}
+
+// parseZhNumber parses "15", "三", "十二" or "两" (0-99)
+func parseZhNumber(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	digits := map[rune]int{'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	n, tens := 0, false
+	for _, ch := range s {
+		if ch == '十' {
+			if n == 0 {
+				n = 1
+			}
+			n *= 10
+			tens = true
+			continue
+		}
+		d, ok := digits[ch]
+		if !ok {
+			return -1
+		}
+		if tens {
+			n += d
+		} else {
+			n = n*10 + d
+		}
+	}
+	return n
+}
+
+func validDate(year, month, day int) bool {
+	if month < 1 || month > 12 || day < 1 {
+		return false
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local).Day() == day
+}
+
+func uniqueSortedInts(values []int) []int {
+	sort.Ints(values)
+	var out []int
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOf(values []string, v string) int {
+	for i, x := range values {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"goblog/models"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// 2026-10-19 是周一
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		input      string
+		content    string
+		due        string // datetime-local 格式，空表示没有截止时间
+		priority   int
+		tags       []string
+		recurrence string
+	}{
+		// 日期和时间
+		{"明天下午3点 交房租 !high #家务", "交房租", "2026-10-20T15:00", models.TodoPriorityHigh, []string{"家务"}, ""},
+		{"后天 写周报", "写周报", "2026-10-21T23:59", 0, nil, ""},
+		{"大后天上午10点半 体检", "体检", "2026-10-22T10:30", 0, nil, ""},
+		{"今晚8点 倒垃圾", "倒垃圾", "2026-10-19T20:00", 0, nil, ""},
+		{"明晚 看电影", "看电影", "2026-10-20T20:00", 0, nil, ""},
+		{"明早 跑步", "跑步", "2026-10-20T08:00", 0, nil, ""},
+		{"2026-11-03 续签合同", "续签合同", "2026-11-03T23:59", 0, nil, ""},
+		{"12月25日 买礼物", "买礼物", "2026-12-25T23:59", 0, nil, ""},
+		{"3月1日 交税", "交税", "2027-03-01T23:59", 0, nil, ""},
+		{"3天后 还书", "还书", "2026-10-22T23:59", 0, nil, ""},
+		{"周五前 交报告", "交报告", "2026-10-23T23:59", 0, nil, ""},
+		{"下周三 开会", "开会", "2026-10-28T23:59", 0, nil, ""},
+		{"10:30 站会", "站会", "2026-10-19T10:30", 0, nil, ""},
+		{"下午两点 开会", "开会", "2026-10-19T14:00", 0, nil, ""},
+		{"9点20分 打电话", "打电话", "2026-10-20T09:20", 0, nil, ""},
+		{"tomorrow 9am dentist", "dentist", "2026-10-20T09:00", 0, nil, ""},
+		{"call mom tonight at 9:30", "call mom", "2026-10-19T21:30", 0, nil, ""},
+		{"next friday pay rent", "pay rent", "2026-10-30T23:59", 0, nil, ""},
+		{"in 2 days renew passport", "renew passport", "2026-10-21T23:59", 0, nil, ""},
+
+		// 重复规则
+		{"every Monday 9am standup", "standup", "2026-10-26T09:00", 0, nil, "weekly:1"},
+		{"每个工作日 写日报", "写日报", "2026-10-19T23:59", 0, nil, "weekly:1,2,3,4,5"},
+		{"每周二、四 健身", "健身", "2026-10-20T23:59", 0, nil, "weekly:2,4"},
+		{"每天 喝水", "喝水", "", 0, nil, "daily"},
+		{"每月 交房租", "交房租", "", 0, nil, "monthly"},
+		{"每隔10天 换滤芯", "换滤芯", "", 0, nil, "after:10"},
+
+		// 优先级和标签
+		{"整理照片 !低 #家 #家", "整理照片", "", models.TodoPriorityLow, []string{"家"}, ""},
+		{"感叹号!不是优先级", "感叹号!不是优先级", "", 0, nil, ""},
+		{"!unknown 任务", "!unknown 任务", "", 0, nil, ""},
+
+		// 不是时间的数字和量词保持原样
+		{"买2点心", "买2点心", "", 0, nil, ""},
+		{"看3点钟方向的视频", "看3点钟方向的视频", "", 0, nil, ""},
+		{"订10点半的会议室", "订10点半的会议室", "", 0, nil, ""},
+		{"快一点 完成", "快一点 完成", "", 0, nil, ""},
+		{"读完第5章", "读完第5章", "", 0, nil, ""},
+		{"2月30日 无效日期", "2月30日 无效日期", "", 0, nil, ""},
+
+		// 整句都是日期时保留原文
+		{"明天", "明天", "2026-10-20T23:59", 0, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := parseQuickAdd(tt.input, now)
+			if got.Content != tt.content {
+				t.Errorf("content = %q, want %q", got.Content, tt.content)
+			}
+			if got.Due != tt.due || got.HasDue != (tt.due != "") {
+				t.Errorf("due = %q (has %v), want %q", got.Due, got.HasDue, tt.due)
+			}
+			if got.Priority != tt.priority {
+				t.Errorf("priority = %d, want %d", got.Priority, tt.priority)
+			}
+			if !reflect.DeepEqual(got.Tags, tt.tags) {
+				t.Errorf("tags = %q, want %q", got.Tags, tt.tags)
+			}
+			if got.Recurrence != tt.recurrence {
+				t.Errorf("recurrence = %q, want %q", got.Recurrence, tt.recurrence)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence rules stored in todos.recurrence_rule:
+//
+//	daily          每天
+//	weekly:1,3,5   每周的指定几天（0 = 周日）
+//	monthly        每月同一天（按截止日期）
+//	after:N        完成后 N 天
+const (
+	recurrenceDaily   = "daily"
+	recurrenceWeekly  = "weekly"
+	recurrenceMonthly = "monthly"
+	recurrenceAfter   = "after"
+)
+
+// maxRecurrenceAfterDays 限制"完成后 N 天"的 N
+const maxRecurrenceAfterDays = 365
+
+var weekdayNames = []string{"日", "一", "二", "三", "四", "五", "六"}
+
+// parseRecurrenceForm builds a recurrence rule from the todo form.
+// It returns "" when the todo does not repeat.
+func parseRecurrenceForm(r *http.Request) (string, error) {
+	switch r.FormValue("recurrence") {
+	case "", "none":
+		return "", nil
+	case recurrenceDaily:
+		return recurrenceDaily, nil
+	case recurrenceMonthly:
+		return recurrenceMonthly, nil
+	case recurrenceWeekly:
+		r.ParseForm()
+		var days []int
+		seen := make(map[int]bool)
+		for _, v := range r.Form["recurrence_days"] {
+			day, err := strconv.Atoi(v)
+			if err != nil || day < 0 || day > 6 || seen[day] {
+				continue
+			}
+			seen[day] = true
+			days = append(days, day)
+		}
+		if len(days) == 0 {
+			return "", fmt.Errorf("请至少选择一天")
+		}
+		sort.Ints(days)
+		parts := make([]string, len(days))
+		for i, d := range days {
+			parts[i] = strconv.Itoa(d)
+		}
+		return recurrenceWeekly + ":" + strings.Join(parts, ","), nil
+	case recurrenceAfter:
+		n, err := strconv.Atoi(r.FormValue("recurrence_after"))
+		if err != nil || n < 1 || n > maxRecurrenceAfterDays {
+			return "", fmt.Errorf("间隔天数必须在 1 到 %d 之间", maxRecurrenceAfterDays)
+		}
+		return fmt.Sprintf("%s:%d", recurrenceAfter, n), nil
+	}
+	return "", fmt.Errorf("未知的重复规则")
+}
+
+// describeRecurrence returns a human readable label for a recurrence rule
+func describeRecurrence(rule string) string {
+	kind, arg, _ := strings.Cut(rule, ":")
+	switch kind {
+	case recurrenceDaily:
+		return "每天"
+	case recurrenceMonthly:
+		return "每月"
+	case recurrenceWeekly:
+		var names []string
+		for _, d := range weeklyDays(arg) {
+			names = append(names, weekdayNames[d])
+		}
+		return "每周" + strings.Join(names, "、")
+	case recurrenceAfter:
+		return "完成后 " + arg + " 天"
+	}
+	return ""
+}
+
+// weeklyDays parses the "1,3,5" part of a weekly rule
+func weeklyDays(arg string) []int {
+	var days []int
+	for _, p := range strings.Split(arg, ",") {
+		if d, err := strconv.Atoi(p); err == nil && d >= 0 && d <= 6 {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// nextOccurrence computes the due date of the instance following one due at
+// due (zero if it had none) and completed at completedAt. Fixed schedules skip
+// occurrences that are already in the past.
+func nextOccurrence(rule string, due, completedAt time.Time) (time.Time, bool) {
+	kind, arg, _ := strings.Cut(rule, ":")
+
+	base := due
+	if base.IsZero() {
+		// 没有截止时间的实例以完成当天的 23:59 为基准
+		base = time.Date(completedAt.Year(), completedAt.Month(), completedAt.Day(), 23, 59, 0, 0, time.Local)
+	}
+
+	switch kind {
+	case recurrenceAfter:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return time.Time{}, false
+		}
+		next := completedAt.AddDate(0, 0, n)
+		return time.Date(next.Year(), next.Month(), next.Day(), base.Hour(), base.Minute(), 0, 0, time.Local), true
+
+	case recurrenceDaily:
+		next := base.AddDate(0, 0, 1)
+		for !next.After(completedAt) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next, true
+
+	case recurrenceWeekly:
+		days := weeklyDays(arg)
+		if len(days) == 0 {
+			return time.Time{}, false
+		}
+		allowed := make(map[time.Weekday]bool)
+		for _, d := range days {
+			allowed[time.Weekday(d)] = true
+		}
+		next := base.AddDate(0, 0, 1)
+		for !allowed[next.Weekday()] || !next.After(completedAt) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next, true
+
+	case recurrenceMonthly:
+		for i := 1; ; i++ {
+			next := addMonthsClamped(base, i)
+			if next.After(completedAt) {
+				return next, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// addMonthsClamped adds months keeping the day of month, clamped to the month's last day
+// (e.g. Jan 31 + 1 month = Feb 28/29 rather than Mar 3)
+func addMonthsClamped(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// scheduleNextTodoInstance creates the next instance of a recurring todo after
+// one of its instances is completed. Nothing is created while another instance
+// of the series is still pending, so toggling back and forth cannot pile them up.
+func scheduleNextTodoInstance(userID, todoID int) {
+	var content, rule, tags string
+	var priority, seriesID int
+	var projectID interface{}
+	var due sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT content, COALESCE(recurrence_rule, ''), priority, project_id, due_date, COALESCE(series_id, id), COALESCE(tags, '')
+		FROM todos
+		WHERE id = ? AND user_id = ?
+	`, todoID, userID).Scan(&content, &rule, &priority, &projectID, &due, &seriesID, &tags)
+	if err != nil || rule == "" {
+		return
+	}
+
+	var pending int
+	db.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE series_id = ? AND user_id = ? AND status <> 'completed'", seriesID, userID).Scan(&pending)
+	if pending > 0 {
+		return
+	}
+
+	next, ok := nextOccurrence(rule, due.Time, time.Now())
+	if !ok {
+		log.Printf("Invalid recurrence rule %q on todo %d", rule, todoID)
+		return
+	}
+
+	_, err = db.DB.Exec(
+		"INSERT INTO todos (user_id, content, due_date, priority, project_id, recurrence_rule, series_id, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, content, next, priority, projectID, rule, seriesID, tags,
+	)
+	if err != nil {
+		log.Println("Error scheduling next todo instance:", err)
+	}
+}
+
+// loadTodoSeries loads every instance of a recurring todo, newest first
+func loadTodoSeries(userID, seriesID int) []models.Todo {
+	rows, err := db.DB.Query("SELECT id, content, status, due_date, created_at FROM todos WHERE series_id = ? AND user_id = ? ORDER BY id DESC", seriesID, userID)
+	if err != nil {
+		log.Printf("Error fetching todo series: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var instances []models.Todo
+	for rows.Next() {
+		var t models.Todo
+		var dueDate sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Content, &t.Status, &dueDate, &t.CreatedAt); err != nil {
+			log.Printf("Error scanning todo instance: %v", err)
+			continue
+		}
+		if dueDate.Valid {
+			t.DueDate = dueDate.Time
+		}
+		instances = append(instances, t)
+	}
+	return instances
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"goblog/auth"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	todoStatsDays  = 14 // 每日完成数显示的天数
+	todoStatsWeeks = 12 // 每周完成数显示的周数
+)
+
+// TodoStatsHandler shows the user's completion history and productivity stats
+func TodoStatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user session
+	session, _ := auth.ValidateSession(r)
+
+	data := struct {
+		ActivePage string
+		Stats      models.TodoStats
+		Recent     []models.Todo
+		User       *auth.Session
+		IsLoggedIn bool
+	}{
+		ActivePage: "todos",
+		Stats:      loadTodoStats(userID, time.Now()),
+		Recent:     loadRecentCompletedTodos(userID, 20),
+		User:       session,
+		IsLoggedIn: session != nil,
+	}
+
+	renderTemplate(w, "todo_stats.html", data)
+}
+
+// loadTodoStats computes completion counts, punctuality, lead time and the
+// completion streak from completed_at. Todos completed before completed_at
+// was recorded are not counted.
+func loadTodoStats(userID int, now time.Time) models.TodoStats {
+	var stats models.TodoStats
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var avgLead sql.NullFloat64
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(due_date IS NOT NULL AND completed_at <= due_date), 0),
+			COALESCE(SUM(due_date IS NOT NULL AND completed_at > due_date), 0),
+			AVG(TIMESTAMPDIFF(SECOND, created_at, completed_at))
+		FROM todos
+		WHERE user_id = ? AND completed_at IS NOT NULL
+	`, userID).Scan(&stats.CompletedTotal, &stats.OnTime, &stats.Late, &avgLead)
+	if err != nil {
+		log.Printf("Error fetching todo stats: %v", err)
+		return stats
+	}
+	if avgLead.Valid && avgLead.Float64 > 0 {
+		stats.AvgLeadTime = int(avgLead.Float64)
+	}
+	if stats.OnTime+stats.Late > 0 {
+		stats.OnTimeRate = stats.OnTime * 100 / (stats.OnTime + stats.Late)
+	}
+
+	// 每天的完成数，用于每日/每周图表和连续天数
+	byDate := make(map[string]int)
+	var dates []time.Time // 有完成记录的日期，从新到旧
+	rows, err := db.DB.Query(`
+		SELECT DATE(completed_at) AS day, COUNT(*)
+		FROM todos
+		WHERE user_id = ? AND completed_at IS NOT NULL
+		GROUP BY day
+		ORDER BY day DESC
+	`, userID)
+	if err != nil {
+		log.Printf("Error fetching todo completions: %v", err)
+		return stats
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			continue
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+		byDate[day.Format("2006-01-02")] = count
+		dates = append(dates, day)
+	}
+
+	stats.CompletedToday = byDate[today.Format("2006-01-02")]
+	for i := 0; i < 7; i++ {
+		stats.CompletedWeek += byDate[today.AddDate(0, 0, -i).Format("2006-01-02")]
+	}
+
+	stats.Daily = make([]models.CountTotal, todoStatsDays)
+	for i := range stats.Daily {
+		day := today.AddDate(0, 0, i-todoStatsDays+1)
+		stats.Daily[i] = models.CountTotal{Label: day.Format("01-02"), Count: byDate[day.Format("2006-01-02")]}
+	}
+	stats.Daily = withCountPercents(stats.Daily)
+
+	// 周一为一周的开始
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	stats.Weekly = make([]models.CountTotal, todoStatsWeeks)
+	for i := range stats.Weekly {
+		start := monday.AddDate(0, 0, 7*(i-todoStatsWeeks+1))
+		count := 0
+		for d := 0; d < 7; d++ {
+			count += byDate[start.AddDate(0, 0, d).Format("2006-01-02")]
+		}
+		stats.Weekly[i] = models.CountTotal{Label: start.Format("01-02"), Count: count}
+	}
+	stats.Weekly = withCountPercents(stats.Weekly)
+
+	stats.CurrentStreak, stats.LongestStreak = completionStreaks(dates, today)
+	return stats
+}
+
+// completionStreaks returns the current and the longest run of consecutive
+// days in dates (newest first). The current streak still counts when today
+// has no completion yet but yesterday has.
+func completionStreaks(dates []time.Time, today time.Time) (current, longest int) {
+	run := 0
+	for i, day := range dates {
+		if i > 0 && dates[i-1].AddDate(0, 0, -1).Equal(day) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		// 当前连续：从今天或昨天开始、中间不断
+		if i == run-1 && (dates[0].Equal(today) || dates[0].Equal(today.AddDate(0, 0, -1))) {
+			current = run
+		}
+	}
+	return current, longest
+}
+
+// withCountPercents fills Percent relative to the largest count
+func withCountPercents(totals []models.CountTotal) []models.CountTotal {
+	max := 0
+	for _, t := range totals {
+		if t.Count > max {
+			max = t.Count
+		}
+	}
+	if max > 0 {
+		for i := range totals {
+			totals[i].Percent = totals[i].Count * 100 / max
+		}
+	}
+	return totals
+}
+
+// loadRecentCompletedTodos loads the most recently completed todos
+func loadRecentCompletedTodos(userID, limit int) []models.Todo {
+	rows, err := db.DB.Query(`
+		SELECT id, content, due_date, created_at, completed_at
+		FROM todos
+		WHERE user_id = ? AND completed_at IS NOT NULL
+		ORDER BY completed_at DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		log.Printf("Error fetching completed todos: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		var t models.Todo
+		var dueDate sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Content, &dueDate, &t.CreatedAt, &t.CompletedAt); err != nil {
+			log.Printf("Error scanning completed todo: %v", err)
+			continue
+		}
+		t.DueDate = dueDate.Time
+		t.Status = "completed"
+		todos = append(todos, t)
+	}
+	return todos
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"goblog/db"
+	"goblog/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pomodoroDefaultMinutes = 25        // 番茄钟默认时长
+	pomodoroMaxMinutes     = 120       // 番茄钟最长时长
+	maxTodoSessionSeconds  = 12 * 3600 // 忘记停止的计时器最多记 12 小时
+)
+
+// StartTodoTimerHandler starts a timer or pomodoro on a todo. A user has at
+// most one running session, so any running one is stopped first.
+func StartTodoTimerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	var count int
+	db.DB.QueryRow("SELECT COUNT(*) FROM todos WHERE id = ? AND user_id = ?", id, userID).Scan(&count)
+	if count == 0 {
+		http.Error(w, "任务不存在", http.StatusNotFound)
+		return
+	}
+
+	kind, planned := "timer", 0
+	if r.FormValue("kind") == "pomodoro" {
+		kind = "pomodoro"
+		planned, _ = strconv.Atoi(r.FormValue("minutes"))
+		if planned <= 0 {
+			planned = pomodoroDefaultMinutes
+		}
+		if planned > pomodoroMaxMinutes {
+			planned = pomodoroMaxMinutes
+		}
+	}
+
+	now := time.Now()
+	stopRunningTodoSessions(userID, now)
+
+	_, err := db.DB.Exec("INSERT INTO todo_sessions (todo_id, user_id, kind, planned_minutes, started_at) VALUES (?, ?, ?, ?, ?)",
+		id, userID, kind, planned, now)
+	if err != nil {
+		log.Println("Error starting todo timer:", err)
+	}
+
+	http.Redirect(w, r, todoRedirectTarget(r), http.StatusSeeOther)
+}
+
+// StopTodoTimerHandler stops the user's running timer or pomodoro
+func StopTodoTimerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stopRunningTodoSessions(userID, time.Now())
+
+	http.Redirect(w, r, todoRedirectTarget(r), http.StatusSeeOther)
+}
+
+// stopRunningTodoSessions ends the user's running sessions at now. Pomodoros
+// count at most their planned length and timers at most maxTodoSessionSeconds.
+func stopRunningTodoSessions(userID int, now time.Time) {
+	rows, err := db.DB.Query("SELECT id, planned_minutes, started_at FROM todo_sessions WHERE user_id = ? AND ended_at IS NULL", userID)
+	if err != nil {
+		log.Println("Error fetching running todo sessions:", err)
+		return
+	}
+	var sessions []models.TodoSession
+	for rows.Next() {
+		var s models.TodoSession
+		if err := rows.Scan(&s.ID, &s.PlannedMinutes, &s.StartedAt); err == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	rows.Close()
+
+	for _, s := range sessions {
+		limit := maxTodoSessionSeconds
+		if s.PlannedMinutes > 0 {
+			limit = s.PlannedMinutes * 60
+		}
+		seconds := int(now.Sub(s.StartedAt).Seconds())
+		if seconds < 0 {
+			seconds = 0
+		}
+		if seconds > limit {
+			seconds = limit
+		}
+		_, err := db.DB.Exec("UPDATE todo_sessions SET ended_at = ?, duration_seconds = ? WHERE id = ? AND user_id = ?",
+			s.StartedAt.Add(time.Duration(seconds)*time.Second), seconds, s.ID, userID)
+		if err != nil {
+			log.Println("Error stopping todo session:", err)
+		}
+	}
+}
+
+// loadActiveTodoSession returns the user's running session, or nil
+func loadActiveTodoSession(userID int) *models.TodoSession {
+	var s models.TodoSession
+	err := db.DB.QueryRow(`
+		SELECT ts.id, ts.todo_id, t.content, ts.kind, ts.planned_minutes, ts.started_at
+		FROM todo_sessions ts
+		INNER JOIN todos t ON ts.todo_id = t.id
+		WHERE ts.user_id = ? AND ts.ended_at IS NULL
+		ORDER BY ts.started_at DESC
+		LIMIT 1
+	`, userID).Scan(&s.ID, &s.TodoID, &s.TodoContent, &s.Kind, &s.PlannedMinutes, &s.StartedAt)
+	if err != nil {
+		return nil
+	}
+	return &s
+}
+
+// loadTodoSessions loads the finished sessions of a todo, newest first
+func loadTodoSessions(userID, todoID int) []models.TodoSession {
+	rows, err := db.DB.Query(`
+		SELECT id, kind, planned_minutes, started_at, ended_at, duration_seconds
+		FROM todo_sessions
+		WHERE todo_id = ? AND user_id = ? AND ended_at IS NOT NULL
+		ORDER BY started_at DESC
+		LIMIT 50
+	`, todoID, userID)
+	if err != nil {
+		log.Printf("Error fetching todo sessions: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var sessions []models.TodoSession
+	for rows.Next() {
+		var s models.TodoSession
+		var endedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Kind, &s.PlannedMinutes, &s.StartedAt, &endedAt, &s.Duration); err != nil {
+			log.Printf("Error scanning todo session: %v", err)
+			continue
+		}
+		s.TodoID = todoID
+		s.EndedAt = endedAt.Time
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// todoTimeByDay sums the time spent per day in [from, from+days), oldest day
+// first; todoID 0 covers all of the user's todos
+func todoTimeByDay(userID, todoID int, from time.Time, days int) []models.TimeTotal {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	query := "SELECT DATE(started_at), COALESCE(SUM(duration_seconds), 0) FROM todo_sessions WHERE user_id = ? AND started_at >= ? AND started_at < ?"
+	args := []interface{}{userID, start, start.AddDate(0, 0, days)}
+	if todoID > 0 {
+		query += " AND todo_id = ?"
+		args = append(args, todoID)
+	}
+	query += " GROUP BY DATE(started_at)"
+
+	byDate := make(map[string]int)
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error fetching daily todo time: %v", err)
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var day time.Time
+			var seconds int
+			if err := rows.Scan(&day, &seconds); err == nil {
+				byDate[day.Format("2006-01-02")] = seconds
+			}
+		}
+	}
+
+	totals := make([]models.TimeTotal, days)
+	for i := range totals {
+		day := start.AddDate(0, 0, i)
+		totals[i] = models.TimeTotal{Label: day.Format("01-02"), Seconds: byDate[day.Format("2006-01-02")]}
+	}
+	return withTimePercents(totals)
+}
+
+// todoTimeByProject sums the time spent per project since from
+func todoTimeByProject(userID int, from time.Time) []models.TimeTotal {
+	return queryTimeTotals(`
+		SELECT COALESCE(p.name, '未分类'), COALESCE(p.color, '#94A3B8'), SUM(ts.duration_seconds) AS seconds
+		FROM todo_sessions ts
+		INNER JOIN todos t ON ts.todo_id = t.id
+		LEFT JOIN todo_projects p ON t.project_id = p.id
+		WHERE ts.user_id = ? AND ts.started_at >= ?
+		GROUP BY p.id, p.name, p.color
+		HAVING seconds > 0
+		ORDER BY seconds DESC
+	`, userID, from)
+}
+
+// todoTimeByTodo returns the todos the user spent the most time on since from
+func todoTimeByTodo(userID int, from time.Time, limit int) []models.TimeTotal {
+	return queryTimeTotals(`
+		SELECT t.content, '#3B82F6', SUM(ts.duration_seconds) AS seconds
+		FROM todo_sessions ts
+		INNER JOIN todos t ON ts.todo_id = t.id
+		WHERE ts.user_id = ? AND ts.started_at >= ?
+		GROUP BY t.id, t.content
+		HAVING seconds > 0
+		ORDER BY seconds DESC
+		LIMIT ?
+	`, userID, from, limit)
+}
+
+func queryTimeTotals(query string, args ...interface{}) []models.TimeTotal {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error fetching todo time report: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var totals []models.TimeTotal
+	for rows.Next() {
+		var t models.TimeTotal
+		if err := rows.Scan(&t.Label, &t.Color, &t.Seconds); err != nil {
+			log.Printf("Error scanning todo time report: %v", err)
+			continue
+		}
+		totals = append(totals, t)
+	}
+	return withTimePercents(totals)
+}
+
+// withTimePercents fills Percent relative to the largest total
+func withTimePercents(totals []models.TimeTotal) []models.TimeTotal {
+	max := 0
+	for _, t := range totals {
+		if t.Seconds > max {
+			max = t.Seconds
+		}
+	}
+	if max > 0 {
+		for i := range totals {
+			totals[i].Percent = totals[i].Seconds * 100 / max
+		}
+	}
+	return totals
+}
+
+// sumTimeTotals adds up the seconds of a report
+func sumTimeTotals(totals []models.TimeTotal) int {
+	sum := 0
+	for _, t := range totals {
+		sum += t.Seconds
+	}
+	return sum
+}
+
+// formatDuration renders seconds as "2小时5分钟", "12分钟" or "30秒"
+func formatDuration(seconds int) string {
+	if seconds < 60 {
+		return fmt.Sprintf("%d秒", seconds)
+	}
+	hours, minutes := seconds/3600, seconds%3600/60
+	if hours == 0 {
+		return fmt.Sprintf("%d分钟", minutes)
+	}
+	if minutes == 0 {
+		return fmt.Sprintf("%d小时", hours)
+	}
+	return fmt.Sprintf("%d小时%d分钟", hours, minutes)
+}
+
+// todoRedirectTarget returns where a todo form should go back to; only todo
+// pages are allowed
+func todoRedirectTarget(r *http.Request) string {
+	target := r.FormValue("redirect")
+	if strings.HasPrefix(target, "/todos") {
+		return target
+	}
+	return "/todos"
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"goblog/auth"
 	"goblog/db"
 	"goblog/models"
@@ -24,33 +25,85 @@ func TodosHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user session
 	session, _ := auth.ValidateSession(r)
 
+	sortKey := r.URL.Query().Get("sort")
+	orderBy, known := todoSortOrders[sortKey]
+	if !known {
+		sortKey = "default"
+		orderBy = todoSortOrders[sortKey]
+	}
+	projectFilter, _ := strconv.Atoi(r.URL.Query().Get("project"))
+
 	data := struct {
 		ActivePage    string
 		Todos         []models.Todo
+		Projects      []models.TodoProject
+		Weekdays      []string
+		Sort          string
+		ProjectFilter int
 		TotalCount    int
 		PendingCount  int
 		DoneCount     int
 		TotalCheckins int
+		ActiveSession *models.TodoSession
 		User          *auth.Session
 		IsLoggedIn    bool
 	}{
-		ActivePage: "todos",
-		User:       session,
-		IsLoggedIn: session != nil,
+		ActivePage:    "todos",
+		ActiveSession: loadActiveTodoSession(userID),
+		Projects:      loadTodoProjects(userID),
+		Weekdays:      weekdayNames,
+		Sort:          sortKey,
+		ProjectFilter: projectFilter,
+		User:          session,
+		IsLoggedIn:    session != nil,
 	}
 
-	rows, err := db.DB.Query("SELECT id, content, status, due_date FROM todos WHERE user_id = ? ORDER BY status DESC, due_date ASC", userID)
+	query := `
+		SELECT t.id, t.content, t.status, t.due_date, t.priority, COALESCE(t.parent_id, 0),
+			COALESCE(p.id, 0), COALESCE(p.name, ''), COALESCE(p.color, ''),
+			COALESCE(t.recurrence_rule, ''), COALESCE(t.series_id, 0), COALESCE(t.tags, ''), COALESCE(t.column_id, 0), t.completed_at
+		FROM todos t
+		LEFT JOIN todo_projects p ON t.project_id = p.id AND p.user_id = t.user_id
+		WHERE t.user_id = ?
+		AND NOT (t.series_id IS NOT NULL AND t.status = 'completed'
+			AND EXISTS (SELECT 1 FROM todos n WHERE n.series_id = t.series_id AND n.id > t.id))`
+	args := []interface{}{userID}
+	if projectFilter > 0 {
+		query += " AND t.project_id = ?"
+		args = append(args, projectFilter)
+	} else if projectFilter < 0 {
+		// -1 表示只看未归入项目的任务
+		query += " AND p.id IS NULL"
+	}
+	query += " ORDER BY " + orderBy
+
+	// 重复任务已完成的旧实例不在列表中显示，可在打卡记录页查看历史
+	// 子任务挂在父任务下面，父任务不在结果里时（如被筛选掉）子任务单独展示
+	var subtasks []models.Todo
+	parentIndex := make(map[int]int)
+	columns := loadTodoColumns(userID)
+	defaultColumn := resolveTodoColumn(columns, 0, "pending")
+
+	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		log.Println(err)
 	} else {
 		defer rows.Close()
 		for rows.Next() {
 			var t models.Todo
-			var dueDate sql.NullTime
-			rows.Scan(&t.ID, &t.Content, &t.Status, &dueDate)
+			var dueDate, completedAt sql.NullTime
+			var tags string
+			rows.Scan(&t.ID, &t.Content, &t.Status, &dueDate, &t.Priority, &t.ParentID, &t.ProjectID, &t.ProjectName, &t.ProjectColor, &t.Recurrence, &t.SeriesID, &tags, &t.ColumnID, &completedAt)
 			if dueDate.Valid {
 				t.DueDate = dueDate.Time
 			}
+			if completedAt.Valid {
+				t.CompletedAt = completedAt.Time
+			}
+			if tags != "" {
+				t.Tags = strings.Split(tags, ",")
+			}
+			t.RecurrenceLabel = describeRecurrence(t.Recurrence)
 
 			// 获取总打卡次数和最近打卡时间
 			var totalCount int
@@ -64,16 +117,47 @@ func TodosHandler(w http.ResponseWriter, r *http.Request) {
 				data.TotalCheckins += totalCount
 			}
 
-			data.Todos = append(data.Todos, t)
+			// 计数按看板列统计：完成列里的算已完成，其余列都算待完成
 			data.TotalCount++
-			if t.Status == "pending" {
-				data.PendingCount++
+			if i := resolveTodoColumn(columns, t.ColumnID, t.Status); i >= 0 {
+				if columns[i].IsDone {
+					data.DoneCount++
+				} else {
+					data.PendingCount++
+				}
+				// 默认列（第一个未完成列）不单独显示
+				if i != defaultColumn && !columns[i].IsDone {
+					t.ColumnName = columns[i].Name
+				}
 			} else if t.Status == "completed" {
 				data.DoneCount++
+			} else {
+				data.PendingCount++
 			}
+
+			if t.ParentID > 0 {
+				subtasks = append(subtasks, t)
+				continue
+			}
+			parentIndex[t.ID] = len(data.Todos)
+			data.Todos = append(data.Todos, t)
 		}
 	}
 
+	for _, st := range subtasks {
+		i, exists := parentIndex[st.ParentID]
+		if !exists {
+			data.Todos = append(data.Todos, st)
+			continue
+		}
+		parent := &data.Todos[i]
+		parent.Subtasks = append(parent.Subtasks, st)
+		if st.Status == "completed" {
+			parent.SubtaskDone++
+		}
+		parent.Progress = parent.SubtaskDone * 100 / len(parent.Subtasks)
+	}
+
 	renderTemplate(w, "todos.html", data)
 }
 
@@ -93,6 +177,35 @@ func AddTodoHandler(w http.ResponseWriter, r *http.Request) {
 
 	content := r.FormValue("content")
 	dueDateStr := r.FormValue("due_date")
+	priority := parseTodoPriority(r.FormValue("priority"))
+	projectID, _ := strconv.Atoi(r.FormValue("project_id"))
+	parentID, _ := strconv.Atoi(r.FormValue("parent_id"))
+	recurrence, err := parseRecurrenceForm(r)
+	if err != nil {
+		http.Error(w, "重复规则无效："+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 快速添加：勾选"智能识别"时从内容里解析日期、优先级、标签和重复规则，
+	// 表单里明确选择的值优先
+	var tags string
+	if r.FormValue("quick_parse") == "1" {
+		parsed := parseQuickAdd(content, time.Now())
+		content = parsed.Content
+		if dueDateStr == "" && parsed.HasDue {
+			dueDateStr = parsed.Due
+		}
+		if priority == models.TodoPriorityNone {
+			priority = parsed.Priority
+		}
+		if recurrence == "" {
+			recurrence = parsed.Recurrence
+		}
+		tags = strings.Join(parsed.Tags, ",")
+		if runes := []rune(tags); len(runes) > 255 {
+			tags = string(runes[:255])
+		}
+	}
 
 	log.Printf("📝 添加待办事项 - 内容: '%s', 截止时间: '%s'", content, dueDateStr)
 
@@ -103,65 +216,54 @@ func AddTodoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var dueDate time.Time
 	var dueDateToInsert interface{} = nil // 使用nil来处理空日期
-
-	if dueDateStr != "" {
-		// 尝试多种日期格式解析
-		formats := []string{
-			"2006-01-02T15:04",    // HTML datetime-local 格式
-			"2006-01-02 15:04:05", // 标准格式
-			"2006-01-02T15:04:05", // 带秒的格式
-			"2006-01-02",          // 只有日期
-		}
-
-		for _, format := range formats {
-			if parsed, err := time.Parse(format, dueDateStr); err == nil {
-				dueDate = parsed
-				dueDateToInsert = parsed
-
-				break
-			}
-		}
-
-		if dueDateToInsert == nil {
-			log.Printf("⚠️ 无法解析日期格式，将不设置截止时间: %s", dueDateStr)
+	if dueDate, ok := parseTodoDueDate(dueDateStr); ok {
+		// 日期验证：如果设置了截止时间，必须是未来时间
+		if err := validateTodoDueDate(dueDate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		dueDateToInsert = dueDate
 	} else {
 		log.Printf("ℹ️ 未设置截止时间")
 	}
 
-	// 日期验证：如果设置了截止时间，必须是未来时间
-	if dueDateToInsert != nil {
-		now := time.Now()
-		if dueDate.Before(now) {
-			// 严格验证：截止时间不能早于当前时间
-
-			http.Error(w, "截止时间必须是未来时间", http.StatusBadRequest)
+	// 子任务只能挂在自己的顶层任务下，并沿用父任务的项目
+	var parent interface{}
+	if parentID > 0 {
+		var parentProject sql.NullInt64
+		err := db.DB.QueryRow("SELECT project_id FROM todos WHERE id = ? AND user_id = ? AND parent_id IS NULL", parentID, userID).Scan(&parentProject)
+		if err != nil {
+			http.Error(w, "父任务不存在", http.StatusBadRequest)
 			return
-		} else {
-			// 检查是否设置得过近（比如只差几秒，可能误操作）
-			duration := dueDate.Sub(now)
-			if duration < time.Minute {
-				log.Printf("⚠️ 截止时间设置过近: 截止时间=%s, 当前时间=%s, 相差=%s", dueDate.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"), duration)
-				http.Error(w, "截止时间设置过近，请选择一个合理的未来时间", http.StatusBadRequest)
-				return
-			} else {
-
-			}
 		}
-	} else {
-		log.Printf("ℹ️ 未设置截止时间")
+		parent = parentID
+		projectID = int(parentProject.Int64)
+		// 子任务不支持重复
+		recurrence = ""
 	}
 
 	// 插入到数据库
-	_, err := db.DB.Exec("INSERT INTO todos (user_id, content, due_date) VALUES (?, ?, ?)", userID, content, dueDateToInsert)
+	result, err := db.DB.Exec("INSERT INTO todos (user_id, content, due_date, priority, project_id, parent_id, recurrence_rule, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, content, dueDateToInsert, priority, ownedTodoProject(userID, projectID), parent, recurrence, tags)
 	if err != nil {
 
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// 重复任务的第一个实例就是整个系列的 ID
+	if recurrence != "" {
+		if id, err := result.LastInsertId(); err == nil {
+			db.DB.Exec("UPDATE todos SET series_id = ? WHERE id = ?", id, id)
+		}
+	}
+
+	// 新增子任务后父任务不再算作已完成
+	if parent != nil {
+		rollUpTodoCompletion(userID, parentID)
+	}
+
 	// 重定向到待办事项页面
 	http.Redirect(w, r, "/todos", http.StatusSeeOther)
 }
@@ -184,7 +286,8 @@ func ToggleTodoHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get current status
 	var status string
-	err := db.DB.QueryRow("SELECT status FROM todos WHERE id = ? AND user_id = ?", id, userID).Scan(&status)
+	var parentID int
+	err := db.DB.QueryRow("SELECT status, COALESCE(parent_id, 0) FROM todos WHERE id = ? AND user_id = ?", id, userID).Scan(&status, &parentID)
 	if err != nil {
 		http.Redirect(w, r, "/todos", http.StatusSeeOther)
 		return
@@ -195,14 +298,161 @@ func ToggleTodoHandler(w http.ResponseWriter, r *http.Request) {
 		newStatus = "pending"
 	}
 
-	_, err = db.DB.Exec("UPDATE todos SET status = ? WHERE id = ? AND user_id = ?", newStatus, id, userID)
+	_, err = db.DB.Exec("UPDATE todos SET status = ?, "+todoCompletedAtSQL+" WHERE id = ? AND user_id = ?", newStatus, id, userID)
 	if err != nil {
 		log.Println("Error toggling todo:", err)
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
 	}
 
+	afterTodoStatusChange(userID, id, parentID, newStatus)
+
 	http.Redirect(w, r, "/todos", http.StatusSeeOther)
 }
 
+// UpdateTodoHandler edits the content, due date, priority and status of a todo
+func UpdateTodoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	// Get user ID from context
+	userID, ok := GetUserIDFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	var oldStatus string
+	var oldDueDate sql.NullTime
+	var parentID int
+	err := db.DB.QueryRow("SELECT status, due_date, COALESCE(parent_id, 0) FROM todos WHERE id = ? AND user_id = ?", id, userID).Scan(&oldStatus, &oldDueDate, &parentID)
+	if err != nil {
+		http.Error(w, "任务不存在", http.StatusNotFound)
+		return
+	}
+
+	content := strings.TrimSpace(r.FormValue("content"))
+	if content == "" {
+		http.Error(w, "任务内容不能为空", http.StatusBadRequest)
+		return
+	}
+
+	status := r.FormValue("status")
+	if status != "pending" && status != "completed" {
+		status = oldStatus
+	}
+
+	// 截止时间：留空或勾选 clear_due_date 表示清除；未修改的旧时间即使已过期也保留
+	var dueDateToSave interface{} = nil
+	dueDateStr := r.FormValue("due_date")
+	if r.FormValue("clear_due_date") == "" {
+		if dueDate, ok := parseTodoDueDate(dueDateStr); ok {
+			unchanged := oldDueDate.Valid && oldDueDate.Time.Format("2006-01-02 15:04") == dueDate.Format("2006-01-02 15:04")
+			if unchanged {
+				// 未修改时原样保留数据库里的值
+				dueDateToSave = oldDueDate.Time
+			} else {
+				if err := validateTodoDueDate(dueDate); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				dueDateToSave = dueDate
+			}
+		} else if dueDateStr != "" {
+			http.Error(w, "无法识别的截止时间格式", http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, err = db.DB.Exec("UPDATE todos SET content = ?, due_date = ?, priority = ?, status = ?, "+todoCompletedAtSQL+" WHERE id = ? AND user_id = ?",
+		content, dueDateToSave, parseTodoPriority(r.FormValue("priority")), status, id, userID)
+	if err != nil {
+		log.Println("Error updating todo:", err)
+		http.Redirect(w, r, "/todos", http.StatusSeeOther)
+		return
+	}
+
+	if status != oldStatus {
+		afterTodoStatusChange(userID, id, parentID, status)
+	}
+
+	http.Redirect(w, r, "/todos", http.StatusSeeOther)
+}
+
+// todoCompletedAtSQL keeps completed_at in step with status. It must come after
+// the status assignment: MySQL evaluates single-table UPDATE assignments left
+// to right, so status already holds the new value here. Completing an already
+// completed todo keeps its original completion time.
+const todoCompletedAtSQL = "completed_at = CASE WHEN status = 'completed' THEN COALESCE(completed_at, NOW()) ELSE NULL END"
+
+// afterTodoStatusChange keeps subtasks, parents and recurring series in sync
+// after a todo was completed or reopened.
+func afterTodoStatusChange(userID, id, parentID int, newStatus string) {
+	if parentID > 0 {
+		// 子任务状态变化后重新计算父任务
+		rollUpTodoCompletion(userID, parentID)
+	} else if newStatus == "completed" {
+		// 完成父任务时一并完成剩余的子任务
+		_, err := db.DB.Exec("UPDATE todos SET status = 'completed', "+todoCompletedAtSQL+" WHERE parent_id = ? AND user_id = ?", id, userID)
+		if err != nil {
+			log.Println("Error completing subtasks:", err)
+		}
+		// 重复任务：安排下一个实例
+		scheduleNextTodoInstance(userID, id)
+	}
+
+	if newStatus == "completed" {
+		EvaluateBadges(userID)
+	}
+}
+
+// parseTodoDueDate parses a due date submitted by a form as local time, the
+// same zone the database driver uses (loc=Local); ok is false when the value
+// is empty or in an unknown format.
+func parseTodoDueDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	// 尝试多种日期格式解析
+	formats := []string{
+		"2006-01-02T15:04",    // HTML datetime-local 格式
+		"2006-01-02 15:04:05", // 标准格式
+		"2006-01-02T15:04:05", // 带秒的格式
+		"2006-01-02",          // 只有日期
+	}
+
+	for _, format := range formats {
+		if parsed, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return parsed, true
+		}
+	}
+
+	log.Printf("⚠️ 无法解析日期格式，将不设置截止时间: %s", value)
+	return time.Time{}, false
+}
+
+// validateTodoDueDate rejects due dates in the past or too close to now
+func validateTodoDueDate(dueDate time.Time) error {
+	now := time.Now()
+	if dueDate.Before(now) {
+		// 严格验证：截止时间不能早于当前时间
+		return errors.New("截止时间必须是未来时间")
+	}
+
+	// 检查是否设置得过近（比如只差几秒，可能误操作）
+	duration := dueDate.Sub(now)
+	if duration < time.Minute {
+		log.Printf("⚠️ 截止时间设置过近: 截止时间=%s, 当前时间=%s, 相差=%s", dueDate.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"), duration)
+		return errors.New("截止时间设置过近，请选择一个合理的未来时间")
+	}
+	return nil
+}
+
 // CheckinTodoHandler handles todo check-ins
 func CheckinTodoHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -255,18 +505,35 @@ func DeleteTodoHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, _ := strconv.Atoi(r.FormValue("id"))
 
-	// 先删除相关的打卡记录（通过todo_id关联，确保是用户自己的）
-	_, err := db.DB.Exec("DELETE tc FROM todo_checkins tc INNER JOIN todos t ON tc.todo_id = t.id WHERE tc.todo_id = ? AND t.user_id = ?", id, userID)
+	var parentID int
+	db.DB.QueryRow("SELECT COALESCE(parent_id, 0) FROM todos WHERE id = ? AND user_id = ?", id, userID).Scan(&parentID)
+
+	// 先删除相关的打卡记录（通过todo_id关联，确保是用户自己的），包括子任务的
+	_, err := db.DB.Exec("DELETE tc FROM todo_checkins tc INNER JOIN todos t ON tc.todo_id = t.id WHERE (t.id = ? OR t.parent_id = ?) AND t.user_id = ?", id, id, userID)
 	if err != nil {
 		log.Printf("Error deleting todo checkins: %v", err)
 	}
 
-	// 删除todo
+	_, err = db.DB.Exec("DELETE ts FROM todo_sessions ts INNER JOIN todos t ON ts.todo_id = t.id WHERE (t.id = ? OR t.parent_id = ?) AND t.user_id = ?", id, id, userID)
+	if err != nil {
+		log.Printf("Error deleting todo sessions: %v", err)
+	}
+
+	// 删除子任务和todo
+	_, err = db.DB.Exec("DELETE FROM todos WHERE parent_id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Printf("Error deleting subtasks: %v", err)
+	}
 	_, err = db.DB.Exec("DELETE FROM todos WHERE id = ? AND user_id = ?", id, userID)
 	if err != nil {
 		log.Printf("Error deleting todo: %v", err)
 	}
 
+	// 删除子任务后父任务可能已全部完成
+	if parentID > 0 {
+		rollUpTodoCompletion(userID, parentID)
+	}
+
 	http.Redirect(w, r, "/todos", http.StatusSeeOther)
 }
 
@@ -299,6 +566,9 @@ func TodoCheckinsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get user session
+	session, _ := auth.ValidateSession(r)
+
 	data := struct {
 		ActivePage string
 		Todo       models.Todo
@@ -306,13 +576,38 @@ func TodoCheckinsHandler(w http.ResponseWriter, r *http.Request) {
 			ID          int       `json:"id"`
 			CheckinDate time.Time `json:"checkin_date"`
 		}
+		Instances     []models.Todo // 重复任务的所有实例，最新的在前
+		Sessions      []models.TodoSession
+		TotalTime     int                // 累计计时（秒）
+		DailyTime     []models.TimeTotal // 最近 14 天每天的计时
+		ActiveSession *models.TodoSession
+		User          *auth.Session
+		IsLoggedIn    bool
 	}{
-		ActivePage: "todos",
+		ActivePage:    "todos",
+		ActiveSession: loadActiveTodoSession(userID),
+		User:          session,
+		IsLoggedIn:    session != nil,
 	}
 
 	// 获取todo信息
-	err = db.DB.QueryRow("SELECT id, content, status, due_date FROM todos WHERE id = ? AND user_id = ?", todoID, userID).Scan(
-		&data.Todo.ID, &data.Todo.Content, &data.Todo.Status, &data.Todo.DueDate)
+	var dueDate sql.NullTime
+	err = db.DB.QueryRow("SELECT id, content, status, due_date, COALESCE(recurrence_rule, ''), COALESCE(series_id, 0) FROM todos WHERE id = ? AND user_id = ?", todoID, userID).Scan(
+		&data.Todo.ID, &data.Todo.Content, &data.Todo.Status, &dueDate, &data.Todo.Recurrence, &data.Todo.SeriesID)
+	if dueDate.Valid {
+		data.Todo.DueDate = dueDate.Time
+	}
+	data.Todo.RecurrenceLabel = describeRecurrence(data.Todo.Recurrence)
+
+	// 重复任务的实例历史
+	if data.Todo.SeriesID > 0 {
+		data.Instances = loadTodoSeries(userID, data.Todo.SeriesID)
+	}
+
+	// 计时记录
+	data.Sessions = loadTodoSessions(userID, todoID)
+	db.DB.QueryRow("SELECT COALESCE(SUM(duration_seconds), 0) FROM todo_sessions WHERE todo_id = ? AND user_id = ?", todoID, userID).Scan(&data.TotalTime)
+	data.DailyTime = todoTimeByDay(userID, todoID, time.Now().AddDate(0, 0, -13), 14)
 
 	// 获取打卡记录
 	rows, err := db.DB.Query("SELECT id, checkin_date FROM todo_checkins tc INNER JOIN todos t ON tc.todo_id = t.id WHERE tc.todo_id = ? AND t.user_id = ? ORDER BY checkin_date DESC LIMIT 50", todoID, userID)
@@ -62,8 +62,9 @@ func CreateUser(username, email, hashedPassword string) (*models.User, error) {
 		Password: hashedPassword,
 	}
 
-	// Create badges for new user
+	// Create badges and board columns for new user
 	db.CreateUserBadges(user.ID)
+	db.CreateUserTodoColumns(user.ID)
 
 	return user, nil
 }
@@ -13,6 +13,11 @@ CREATE TABLE IF NOT EXISTS users (
     username VARCHAR(255) UNIQUE NOT NULL,
     email VARCHAR(255) UNIQUE NOT NULL,
     password VARCHAR(255) NOT NULL,
+    calendar_token VARCHAR(64) NULL UNIQUE,
+    diary_digest TINYINT DEFAULT 0,
+    -- 私密日记：口令派生密钥的盐和校验值，未设置口令时为 NULL
+    diary_key_salt VARCHAR(64) NULL,
+    diary_key_check VARCHAR(255) NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -64,15 +69,65 @@ CREATE TABLE IF NOT EXISTS habits (
     frequency VARCHAR(50),
     streak INT DEFAULT 0,
     total_days INT DEFAULT 0,
+    archived_at DATETIME NULL,
+    routine_id INT NULL,
+    sort_order INT DEFAULT 0,
+    target_value INT DEFAULT 0,
+    target_unit VARCHAR(20) DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 7.1 创建习惯分组（晨间/晚间例程）表
+CREATE TABLE IF NOT EXISTS habit_routines (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) DEFAULT 'custom',
+    reminder_time VARCHAR(5) DEFAULT '',
+    sort_order INT DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
 
+-- 7.2 创建习惯模板库表（内置模板会在程序启动时自动写入）
+CREATE TABLE IF NOT EXISTS habit_templates (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(64) UNIQUE NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    category VARCHAR(50) DEFAULT 'other',
+    icon VARCHAR(50),
+    frequency VARCHAR(50) DEFAULT 'daily',
+    target_value INT DEFAULT 0,
+    target_unit VARCHAR(20) DEFAULT '',
+    routine_kind VARCHAR(20) DEFAULT '',
+    sort_order INT DEFAULT 0,
+    is_active INT DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
 -- 8. 创建习惯记录表
 CREATE TABLE IF NOT EXISTS habit_logs (
     id INT PRIMARY KEY AUTO_INCREMENT,
     habit_id INT,
     date DATETIME,
+    note VARCHAR(500) DEFAULT '',
+    mood VARCHAR(16) DEFAULT '',
+    duration_minutes INT DEFAULT 0,
+    FOREIGN KEY(habit_id) REFERENCES habits(id)
+);
+
+-- 8.1 创建习惯暂停/请假表
+CREATE TABLE IF NOT EXISTS habit_pauses (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    habit_id INT NOT NULL,
+    kind VARCHAR(20) DEFAULT 'pause',
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    reason VARCHAR(255) DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_habit_pauses_habit (habit_id, start_date, end_date),
     FOREIGN KEY(habit_id) REFERENCES habits(id)
 );
 
@@ -83,6 +138,42 @@ CREATE TABLE IF NOT EXISTS todos (
     content TEXT,
     status VARCHAR(50) DEFAULT 'pending',
     due_date DATETIME,
+    priority INT DEFAULT 0,
+    project_id INT NULL,
+    parent_id INT NULL,
+    recurrence_rule VARCHAR(50) DEFAULT '',
+    series_id INT NULL,
+    tags VARCHAR(255) DEFAULT '',
+    column_id INT NULL,
+    board_order INT DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME NULL,
+    ical_uid VARCHAR(255) DEFAULT '',
+    INDEX idx_todos_parent (parent_id),
+    INDEX idx_todos_series (series_id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 9.1 创建待办项目（清单）表
+CREATE TABLE IF NOT EXISTS todo_projects (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    color VARCHAR(20) DEFAULT '#3B82F6',
+    sort_order INT DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 9.2 创建看板列表（每个用户的工作流，首次打开看板时自动创建默认列）
+CREATE TABLE IF NOT EXISTS todo_columns (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    color VARCHAR(20) DEFAULT '#64748B',
+    wip_limit INT DEFAULT 0,
+    is_done INT DEFAULT 0,
+    sort_order INT DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
@@ -96,18 +187,63 @@ CREATE TABLE IF NOT EXISTS todo_checkins (
     FOREIGN KEY(todo_id) REFERENCES todos(id)
 );
 
--- 11. 创建徽章表
+-- 10.1 创建待办计时表（计时器和番茄钟，ended_at 为空表示正在计时）
+CREATE TABLE IF NOT EXISTS todo_sessions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    todo_id INT NOT NULL,
+    user_id INT NOT NULL,
+    kind VARCHAR(20) DEFAULT 'timer',
+    planned_minutes INT DEFAULT 0,
+    started_at DATETIME NOT NULL,
+    ended_at DATETIME NULL,
+    duration_seconds INT DEFAULT 0,
+    INDEX idx_todo_sessions_user (user_id, started_at),
+    FOREIGN KEY(todo_id) REFERENCES todos(id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 11. 创建徽章定义表（内置徽章会在程序启动时自动写入）
+CREATE TABLE IF NOT EXISTS badge_definitions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(64) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    icon VARCHAR(50),
+    rule_type VARCHAR(50) NOT NULL,
+    threshold INT NOT NULL DEFAULT 0,
+    sort_order INT DEFAULT 0,
+    is_active INT DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 11.1 创建徽章表
 CREATE TABLE IF NOT EXISTS badges (
     id INT PRIMARY KEY AUTO_INCREMENT,
     user_id INT NOT NULL,
+    code VARCHAR(64),
     name VARCHAR(255),
     description TEXT,
     icon VARCHAR(50),
     unlocked INT DEFAULT 0,
     condition_days INT,
+    unlocked_at DATETIME NULL,
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
 
+-- 11.2 创建徽章解锁记录表
+CREATE TABLE IF NOT EXISTS badge_unlocks (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    badge_id INT NOT NULL,
+    reason VARCHAR(255),
+    metric_value DECIMAL(12,2),
+    notified INT DEFAULT 0,
+    unlocked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_badge_unlocks_user (user_id, notified),
+    FOREIGN KEY(user_id) REFERENCES users(id),
+    FOREIGN KEY(badge_id) REFERENCES badges(id)
+);
+
 -- 12. 创建日记表
 CREATE TABLE IF NOT EXISTS diaries (
     id INT PRIMARY KEY AUTO_INCREMENT,
@@ -117,8 +253,60 @@ CREATE TABLE IF NOT EXISTS diaries (
     weather VARCHAR(50),
     mood VARCHAR(50),
     date DATETIME,
+    -- 1 表示 content 已用用户口令派生的密钥加密
+    encrypted TINYINT DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 全文检索索引（ngram 分词）由程序启动时自动添加；MySQL 没有 ngram 插件时跳过，搜索退回 LIKE 查询
+
+-- 12.1 创建日记历史版本表（每次保存记录一个版本，可对比和恢复）
+CREATE TABLE IF NOT EXISTS diary_revisions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    diary_id INT NOT NULL,
+    user_id INT NOT NULL,
+    title VARCHAR(255),
+    content TEXT,
+    weather VARCHAR(50),
+    mood VARCHAR(50),
+    date DATETIME,
+    encrypted TINYINT DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_diary_revisions_diary (diary_id, id),
+    FOREIGN KEY(diary_id) REFERENCES diaries(id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 12.2 创建日记草稿表（编辑器自动保存，diary_id 为 0 表示新日记，保存日记后删除）
+CREATE TABLE IF NOT EXISTS diary_drafts (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    diary_id INT NOT NULL DEFAULT 0,
+    title VARCHAR(255) DEFAULT '',
+    content TEXT,
+    weather VARCHAR(50) DEFAULT '',
+    mood VARCHAR(50) DEFAULT '',
+    date VARCHAR(10) DEFAULT '',
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_diary_drafts (user_id, diary_id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- 12.3 创建通知收件箱表（提醒调度器写入，dedupe_key 防止重复提醒）
+CREATE TABLE IF NOT EXISTS notifications (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    kind VARCHAR(30) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body VARCHAR(500) DEFAULT '',
+    link VARCHAR(255) DEFAULT '',
+    dedupe_key VARCHAR(100) NOT NULL,
+    is_read INT DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_notification (user_id, dedupe_key),
+    INDEX idx_notifications_unread (user_id, is_read),
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
 
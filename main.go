@@ -43,8 +43,9 @@ func checkBadges() {
 			continue
 		}
 
-		// 为用户创建徽章
+		// 为用户创建徽章，并补发已达成条件的徽章
 		db.CreateUserBadges(userID)
+		handlers.EvaluateBadges(userID)
 		log.Printf("已为用户 %s (ID: %d) 创建徽章", username, userID)
 		count++
 	}
@@ -146,6 +147,9 @@ func setupRoutes() {
 		// 检查并修复所有用户的徽章
 		go checkBadges()
 
+		// 启动待办提醒调度器
+		go handlers.StartReminderScheduler(time.Minute)
+
 		// 注册其他路由
 		setupNormalRoutes()
 	} else {
@@ -205,6 +209,9 @@ func setupNormalRoutes() {
 	http.HandleFunc("/register", handlers.RegisterHandler)
 	http.HandleFunc("/logout", handlers.LogoutHandler)
 
+	// 日历订阅用链接中的 token 认证，不需要登录
+	http.HandleFunc("/ical/", handlers.TodoICalFeedHandler)
+
 	// Protected routes
 	http.HandleFunc("/", handlers.AuthMiddleware(handlers.DashboardHandler))
 
@@ -217,21 +224,70 @@ func setupNormalRoutes() {
 
 	http.HandleFunc("/habits", handlers.AuthMiddleware(handlers.HabitsHandler))
 	http.HandleFunc("/habits/add", handlers.AuthMiddleware(handlers.AddHabitHandler))
+	http.HandleFunc("/habits/templates/adopt", handlers.AuthMiddleware(handlers.AdoptHabitTemplateHandler))
 	http.HandleFunc("/habits/delete", handlers.AuthMiddleware(handlers.DeleteHabitHandler))
+	http.HandleFunc("/habits/archive", handlers.AuthMiddleware(handlers.ArchiveHabitHandler))
+	http.HandleFunc("/habits/unarchive", handlers.AuthMiddleware(handlers.UnarchiveHabitHandler))
 	http.HandleFunc("/habits/checkin", handlers.AuthMiddleware(handlers.CheckinHabitHandler))
+	http.HandleFunc("/habits/logs/update", handlers.AuthMiddleware(handlers.UpdateHabitLogHandler))
+	http.HandleFunc("/habits/pause", handlers.AuthMiddleware(handlers.PauseHabitHandler))
+	http.HandleFunc("/habits/pause/delete", handlers.AuthMiddleware(handlers.DeleteHabitPauseHandler))
+	http.HandleFunc("/habits/history", handlers.AuthMiddleware(handlers.HabitHistoryHandler))
+	http.HandleFunc("/habits/routines/add", handlers.AuthMiddleware(handlers.AddHabitRoutineHandler))
+	http.HandleFunc("/habits/routines/update", handlers.AuthMiddleware(handlers.UpdateHabitRoutineHandler))
+	http.HandleFunc("/habits/routines/delete", handlers.AuthMiddleware(handlers.DeleteHabitRoutineHandler))
+	http.HandleFunc("/api/habits/reorder", handlers.AuthMiddleware(handlers.ReorderHabitsHandler))
 
 	http.HandleFunc("/todos", handlers.AuthMiddleware(handlers.TodosHandler))
 	http.HandleFunc("/todos/add", handlers.AuthMiddleware(handlers.AddTodoHandler))
+	http.HandleFunc("/api/todos/parse", handlers.AuthMiddleware(handlers.ParseTodoQuickAddHandler))
+	http.HandleFunc("/todos/update", handlers.AuthMiddleware(handlers.UpdateTodoHandler))
 	http.HandleFunc("/todos/toggle", handlers.AuthMiddleware(handlers.ToggleTodoHandler))
 	http.HandleFunc("/todos/checkin", handlers.AuthMiddleware(handlers.CheckinTodoHandler))
 	http.HandleFunc("/todos/checkins", handlers.AuthMiddleware(handlers.TodoCheckinsHandler))
 	http.HandleFunc("/todos/delete", handlers.AuthMiddleware(handlers.DeleteTodoHandler))
+	http.HandleFunc("/api/todos/bulk", handlers.AuthMiddleware(handlers.BulkTodosHandler))
+	http.HandleFunc("/todos/projects/add", handlers.AuthMiddleware(handlers.AddTodoProjectHandler))
+	http.HandleFunc("/todos/projects/delete", handlers.AuthMiddleware(handlers.DeleteTodoProjectHandler))
+	http.HandleFunc("/todos/timer/start", handlers.AuthMiddleware(handlers.StartTodoTimerHandler))
+	http.HandleFunc("/todos/timer/stop", handlers.AuthMiddleware(handlers.StopTodoTimerHandler))
+	http.HandleFunc("/todos/ical", handlers.AuthMiddleware(handlers.TodoICalHandler))
+	http.HandleFunc("/todos/ical/reset", handlers.AuthMiddleware(handlers.ResetTodoICalTokenHandler))
+	http.HandleFunc("/todos/ical/import", handlers.AuthMiddleware(handlers.ImportTodoICalHandler))
+	http.HandleFunc("/todos/stats", handlers.AuthMiddleware(handlers.TodoStatsHandler))
+	http.HandleFunc("/todos/board", handlers.AuthMiddleware(handlers.TodoBoardHandler))
+	http.HandleFunc("/todos/columns/add", handlers.AuthMiddleware(handlers.AddTodoColumnHandler))
+	http.HandleFunc("/todos/columns/update", handlers.AuthMiddleware(handlers.UpdateTodoColumnHandler))
+	http.HandleFunc("/todos/columns/delete", handlers.AuthMiddleware(handlers.DeleteTodoColumnHandler))
+	http.HandleFunc("/api/todos/move", handlers.AuthMiddleware(handlers.MoveTodoHandler))
 
 	http.HandleFunc("/diary", handlers.AuthMiddleware(handlers.DiaryHandler))
 	http.HandleFunc("/diary/add", handlers.AuthMiddleware(handlers.AddDiaryHandler))
 	http.HandleFunc("/diary/delete", handlers.AuthMiddleware(handlers.DeleteDiaryHandler))
 	http.HandleFunc("/diary/get", handlers.AuthMiddleware(handlers.GetDiaryHandler))
 	http.HandleFunc("/diary/update", handlers.AuthMiddleware(handlers.UpdateDiaryHandler))
+	http.HandleFunc("/diary/search", handlers.AuthMiddleware(handlers.DiarySearchHandler))
+	http.HandleFunc("/diary/insights", handlers.AuthMiddleware(handlers.MoodInsightsHandler))
+	http.HandleFunc("/diary/memories/digest", handlers.AuthMiddleware(handlers.DiaryDigestToggleHandler))
+	http.HandleFunc("/diary/encryption/setup", handlers.AuthMiddleware(handlers.SetupDiaryEncryptionHandler))
+	http.HandleFunc("/diary/encryption/unlock", handlers.AuthMiddleware(handlers.UnlockDiaryHandler))
+	http.HandleFunc("/diary/encryption/lock", handlers.AuthMiddleware(handlers.LockDiaryHandler))
+	http.HandleFunc("/diary/revisions", handlers.AuthMiddleware(handlers.DiaryRevisionsHandler))
+	http.HandleFunc("/diary/revisions/restore", handlers.AuthMiddleware(handlers.RestoreDiaryRevisionHandler))
+	http.HandleFunc("/api/diary/preview", handlers.AuthMiddleware(handlers.DiaryPreviewHandler))
+	http.HandleFunc("/api/diary/draft", handlers.AuthMiddleware(handlers.GetDiaryDraftHandler))
+	http.HandleFunc("/api/diary/draft/save", handlers.AuthMiddleware(handlers.SaveDiaryDraftHandler))
+	http.HandleFunc("/api/diary/draft/discard", handlers.AuthMiddleware(handlers.DiscardDiaryDraftHandler))
+
+	http.HandleFunc("/calendar", handlers.AuthMiddleware(handlers.CalendarHandler))
+	http.HandleFunc("/api/calendar/events", handlers.AuthMiddleware(handlers.CalendarEventsHandler))
+
+	http.HandleFunc("/achievements", handlers.AuthMiddleware(handlers.AchievementsHandler))
+	http.HandleFunc("/api/badges/unseen", handlers.AuthMiddleware(handlers.UnseenBadgesHandler))
+
+	http.HandleFunc("/inbox", handlers.AuthMiddleware(handlers.InboxHandler))
+	http.HandleFunc("/inbox/read", handlers.AuthMiddleware(handlers.ReadNotificationHandler))
+	http.HandleFunc("/inbox/open", handlers.AuthMiddleware(handlers.OpenNotificationHandler))
 
 	http.HandleFunc("/export", handlers.AuthMiddleware(handlers.ExportHandler))
 
@@ -240,6 +296,9 @@ func setupNormalRoutes() {
 	http.HandleFunc("/admin/users", handlers.AdminAuthMiddleware(handlers.AdminUsersHandler))
 	http.HandleFunc("/admin/users/edit", handlers.AdminAuthMiddleware(handlers.AdminEditUserHandler))
 	http.HandleFunc("/admin/users/delete", handlers.AdminAuthMiddleware(handlers.AdminDeleteUserHandler))
+	http.HandleFunc("/admin/templates", handlers.AdminAuthMiddleware(handlers.AdminHabitTemplatesHandler))
+	http.HandleFunc("/admin/templates/add", handlers.AdminAuthMiddleware(handlers.AdminAddHabitTemplateHandler))
+	http.HandleFunc("/admin/templates/toggle", handlers.AdminAuthMiddleware(handlers.AdminToggleHabitTemplateHandler))
 	http.HandleFunc("/admin/data", handlers.AdminAuthMiddleware(handlers.AdminDataHandler))
 	http.HandleFunc("/admin/data/export", handlers.AdminAuthMiddleware(handlers.AdminExportDataHandler))
 	http.HandleFunc("/admin/data/import", handlers.AdminAuthMiddleware(handlers.AdminImportDataHandler))
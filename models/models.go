@@ -41,23 +41,76 @@ type FinanceGoal struct {
 
 // Habit represents a habit to track
 type Habit struct {
-	ID              int        `json:"id"`
-	Name            string     `json:"name"`
-	Description     string     `json:"description"`
-	Frequency       string     `json:"frequency"` // "daily", "weekly"
-	Streak          int        `json:"streak"`
-	TotalDays       int        `json:"total_days"`
-	TodayChecked    bool       `json:"today_checked"`    // Whether habit is checked today
-	MonthlyProgress int        `json:"monthly_progress"` // 本月进度百分比
-	CreatedAt       time.Time  `json:"created_at"`
-	Logs            []HabitLog `json:"logs"` // For easy access in template
+	ID              int          `json:"id"`
+	Name            string       `json:"name"`
+	Description     string       `json:"description"`
+	Frequency       string       `json:"frequency"` // "daily", "weekly"
+	Streak          int          `json:"streak"`
+	TotalDays       int          `json:"total_days"`
+	TodayChecked    bool         `json:"today_checked"`    // Whether habit is checked today
+	PausedToday     bool         `json:"paused_today"`     // 今日处于暂停或请假状态
+	MonthlyProgress int          `json:"monthly_progress"` // 本月进度百分比
+	Archived        bool         `json:"archived"`
+	ArchivedAt      time.Time    `json:"archived_at"`
+	RoutineID       int          `json:"routine_id"`   // 所属分组，0 表示未分组
+	TargetValue     int          `json:"target_value"` // 每次的目标量，0 表示不设目标
+	TargetUnit      string       `json:"target_unit"`  // 目标单位，如"分钟"、"杯"
+	SortOrder       int          `json:"sort_order"`
+	CreatedAt       time.Time    `json:"created_at"`
+	Logs            []HabitLog   `json:"logs"`      // For easy access in template
+	Pauses          []HabitPause `json:"pauses"`    // 当前及未来的暂停记录
+	TodayLog        HabitLog     `json:"today_log"` // 今日打卡记录，未打卡时 ID 为 0
+}
+
+// HabitRoutine groups habits into a routine such as a morning or evening routine
+type HabitRoutine struct {
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Kind         string  `json:"kind"`          // "morning", "evening", "custom"
+	ReminderTime string  `json:"reminder_time"` // "15:04"，为空表示不提醒
+	SortOrder    int     `json:"sort_order"`
+	Due          bool    `json:"due"`  // 提醒时间已过且仍有未打卡的习惯
+	Done         int     `json:"done"` // 今日已打卡数
+	Habits       []Habit `json:"habits"`
+}
+
+// HabitTemplate is a catalog entry a user can adopt as a new habit
+type HabitTemplate struct {
+	ID          int    `json:"id"`
+	Code        string `json:"code"` // 内置模板的唯一编码，管理员添加的模板为空
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"` // "exercise", "reading", "sleep", "hydration", ...
+	Icon        string `json:"icon"`
+	Frequency   string `json:"frequency"`
+	TargetValue int    `json:"target_value"`
+	TargetUnit  string `json:"target_unit"`
+	RoutineKind string `json:"routine_kind"` // 建议放入的分组类型："morning", "evening" 或空
+	SortOrder   int    `json:"sort_order"`
+	IsActive    bool   `json:"is_active"`
 }
 
 // HabitLog represents a completion of a habit
 type HabitLog struct {
-	ID      int       `json:"id"`
-	HabitID int       `json:"habit_id"`
-	Date    time.Time `json:"date"`
+	ID        int       `json:"id"`
+	HabitID   int       `json:"habit_id"`
+	HabitName string    `json:"habit_name,omitempty"`
+	Date      time.Time `json:"date"`
+	Note      string    `json:"note"`     // 打卡备注
+	Mood      string    `json:"mood"`     // 打卡时的心情，与日记使用相同的表情
+	Duration  int       `json:"duration"` // 持续时长（分钟）
+}
+
+// HabitPause represents a paused date range or an excused (skipped) day.
+// Days covered by a pause don't break streaks and are excluded from progress.
+type HabitPause struct {
+	ID        int       `json:"id"`
+	HabitID   int       `json:"habit_id"`
+	Kind      string    `json:"kind"` // "pause" (date range) or "skip" (single excused day)
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Todo represents a task
@@ -71,15 +124,152 @@ type Todo struct {
 	CheckinCount      int       `json:"checkin_count"`
 	TodayCheckinCount int       `json:"today_checkin_count"`
 	LastCheckin       time.Time `json:"last_checkin"`
+	Priority          int       `json:"priority"` // TodoPriorityNone ... TodoPriorityHigh
+	ProjectID         int       `json:"project_id"`
+	ProjectName       string    `json:"project_name"`
+	ProjectColor      string    `json:"project_color"`
+	ParentID          int       `json:"parent_id"` // 父任务 ID，0 表示顶层任务
+	Subtasks          []Todo    `json:"subtasks"`
+	SubtaskDone       int       `json:"subtask_done"`
+	Progress          int       `json:"progress"`   // 子任务完成百分比
+	Recurrence        string    `json:"recurrence"` // 重复规则，见 handlers/todo_recurrence.go，空表示不重复
+	RecurrenceLabel   string    `json:"recurrence_label"`
+	SeriesID          int       `json:"series_id"` // 同一重复任务的所有实例共享的 ID
+	Tags              []string  `json:"tags"`
+	ColumnID          int       `json:"column_id"` // 看板列，见 handlers/todo_board.go
+	ColumnName        string    `json:"column_name"`
+	CompletedAt       time.Time `json:"completed_at"` // 完成时间，未完成时为零值
 }
 
-// Badge represents an achievement
-type Badge struct {
+// Todo priority levels, higher is more important
+const (
+	TodoPriorityNone   = 0
+	TodoPriorityLow    = 1
+	TodoPriorityMedium = 2
+	TodoPriorityHigh   = 3
+)
+
+// TodoProject is a user-defined list that groups todos
+type TodoProject struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Color        string `json:"color"`
+	SortOrder    int    `json:"sort_order"`
+	PendingCount int    `json:"pending_count"`
+}
+
+// TodoSession is a timed work session on a todo, either a free-running timer
+// or a pomodoro of PlannedMinutes
+type TodoSession struct {
+	ID             int       `json:"id"`
+	TodoID         int       `json:"todo_id"`
+	TodoContent    string    `json:"todo_content"`
+	Kind           string    `json:"kind"` // "timer", "pomodoro"
+	PlannedMinutes int       `json:"planned_minutes"`
+	StartedAt      time.Time `json:"started_at"`
+	EndedAt        time.Time `json:"ended_at"` // 零值表示仍在计时
+	Duration       int       `json:"duration"` // 秒
+}
+
+// TimeTotal is one row of a time report, e.g. the time spent on a project or a day
+type TimeTotal struct {
+	Label   string `json:"label"`
+	Color   string `json:"color"`
+	Seconds int    `json:"seconds"`
+	Percent int    `json:"percent"` // 占报表中最大值的百分比，用于画条形图
+}
+
+// TodoStats summarizes when and how punctually a user completes todos
+type TodoStats struct {
+	CompletedToday int          `json:"completed_today"`
+	CompletedWeek  int          `json:"completed_week"` // 最近 7 天
+	CompletedTotal int          `json:"completed_total"`
+	OnTime         int          `json:"on_time"` // 在截止时间前完成
+	Late           int          `json:"late"`
+	OnTimeRate     int          `json:"on_time_rate"`  // 百分比，只统计有截止时间的任务
+	AvgLeadTime    int          `json:"avg_lead_time"` // 从创建到完成的平均用时（秒）
+	CurrentStreak  int          `json:"current_streak"`
+	LongestStreak  int          `json:"longest_streak"`
+	Daily          []CountTotal `json:"daily"`  // 最近 14 天每天完成数
+	Weekly         []CountTotal `json:"weekly"` // 最近 12 周每周完成数
+}
+
+// CountTotal is one bar of a count chart, e.g. the todos completed on a day
+type CountTotal struct {
+	Label   string `json:"label"`
+	Count   int    `json:"count"`
+	Percent int    `json:"percent"` // 占最大值的百分比
+}
+
+// TodoColumn is a workflow column of a user's todo board. Todos in a done
+// column have status "completed", all others "pending".
+type TodoColumn struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Color     string `json:"color"`
+	WIPLimit  int    `json:"wip_limit"` // 0 表示不限制
+	IsDone    bool   `json:"is_done"`
+	SortOrder int    `json:"sort_order"`
+	Todos     []Todo `json:"todos,omitempty"`
+	OverLimit bool   `json:"over_limit"`
+}
+
+// Badge rule types understood by the badge engine
+const (
+	BadgeRuleHabitStreak    = "habit_streak"     // 任一习惯的连续打卡天数
+	BadgeRuleHabitCheckins  = "habit_checkins"   // 所有习惯的累计打卡次数
+	BadgeRuleDiaryStreak    = "diary_streak"     // 日记最长连续记录天数
+	BadgeRuleTodoCompletion = "todo_completions" // 已完成的待办数量
+	BadgeRuleSavings        = "savings"          // 累计结余金额（收入 - 支出）
+)
+
+// BadgeDefinition describes a badge and the rule that unlocks it
+type BadgeDefinition struct {
 	ID          int    `json:"id"`
+	Code        string `json:"code"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Icon        string `json:"icon"` // FontAwesome class or emoji
-	Unlocked    bool   `json:"unlocked"`
+	Icon        string `json:"icon"`
+	RuleType    string `json:"rule_type"`
+	Threshold   int    `json:"threshold"`
+	SortOrder   int    `json:"sort_order"`
+	IsActive    bool   `json:"is_active"`
+}
+
+// Badge represents an achievement
+type Badge struct {
+	ID          int       `json:"id"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Icon        string    `json:"icon"` // FontAwesome class or emoji
+	Unlocked    bool      `json:"unlocked"`
+	UnlockedAt  time.Time `json:"unlocked_at"`
+}
+
+// BadgeUnlock records when and why a badge was unlocked
+type BadgeUnlock struct {
+	ID          int       `json:"id"`
+	BadgeID     int       `json:"badge_id"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Icon        string    `json:"icon"`
+	Module      string    `json:"module"` // "habits", "diary", "todos", "finance"
+	ModuleName  string    `json:"module_name"`
+	Reason      string    `json:"reason"`
+	UnlockedAt  time.Time `json:"unlocked_at"`
+}
+
+// Notification is an entry of a user's inbox, e.g. a todo reminder
+type Notification struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"` // "todo_due_soon", "todo_overdue"
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Link      string    `json:"link"`
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // User represents a registered user
@@ -91,6 +281,29 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// CalendarEvent is an item placed on the calendar: a todo due date, a habit
+// check-in, a diary entry or a transaction
+type CalendarEvent struct {
+	ID     string    `json:"id"`     // 模块前缀加记录 ID，如 "todo-12"
+	Module string    `json:"module"` // todos, habits, diary, finance
+	Title  string    `json:"title"`
+	Start  time.Time `json:"start"`
+	AllDay bool      `json:"all_day"`
+	Color  string    `json:"color"`
+	Icon   string    `json:"icon"`
+	URL    string    `json:"url"` // 点击后跳转到对应记录
+	Done   bool      `json:"done"`
+}
+
+// CalendarDay is one cell of the calendar
+type CalendarDay struct {
+	Date    time.Time
+	URL     string // 该天的日视图
+	InRange bool   // 月视图中属于当前月
+	IsToday bool
+	Events  []CalendarEvent
+}
+
 // Diary represents a daily diary entry
 type Diary struct {
 	ID        int       `json:"id"`
@@ -99,6 +312,97 @@ type Diary struct {
 	Weather   string    `json:"weather"` // "sunny", "cloudy", "rainy", "snowy", "windy"
 	Mood      string    `json:"mood"`    // emoji representing mood
 	Date      time.Time `json:"date"`
+	Encrypted bool      `json:"encrypted"` // content 为密文，需要解锁后才能查看
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// DiaryMemory is a diary written on today's calendar date in an earlier year
+type DiaryMemory struct {
+	Diary
+	YearsAgo int `json:"years_ago"`
+}
+
+// MoodInsights summarizes diary moods over a period. Moods are mapped to a
+// 1-5 scale (1 = 很差, 5 = 很好).
+type MoodInsights struct {
+	Days         int               `json:"days"`    // 统计范围（天）
+	Entries      int               `json:"entries"` // 有心情记录的天数
+	Average      float64           `json:"average"`
+	Trend        []MoodPoint       `json:"trend"`
+	ByWeekday    []MoodGroup       `json:"by_weekday"`
+	ByWeather    []MoodGroup       `json:"by_weather"`
+	ByMood       []MoodGroup       `json:"by_mood"` // 各心情出现次数
+	Correlations []MoodCorrelation `json:"correlations"`
+}
+
+// MoodPoint is the average mood of one day
+type MoodPoint struct {
+	Date    string  `json:"date"`
+	Score   float64 `json:"score"`
+	Average float64 `json:"average"` // 7 天移动平均
+}
+
+// MoodGroup is the average mood of a group of days, e.g. all Mondays
+type MoodGroup struct {
+	Label   string  `json:"label"`
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+	Percent int     `json:"percent"` // 平均分占满分或次数占最大值的百分比
+}
+
+// MoodCorrelation relates daily mood to a daily metric of another module
+type MoodCorrelation struct {
+	Module   string      `json:"module"`
+	Metric   string      `json:"metric"`
+	Days     int         `json:"days"`
+	Valid    bool        `json:"valid"` // 样本太少或数据没有变化时为 false
+	R        float64     `json:"r"`     // 皮尔逊相关系数
+	Strength string      `json:"strength"`
+	Compare  []MoodGroup `json:"compare"` // 指标高/低的日子各自的平均心情
+}
+
+// DiaryDraft is the autosaved editor state of a diary; DiaryID is 0 for a
+// new entry
+type DiaryDraft struct {
+	DiaryID   int       `json:"diary_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Weather   string    `json:"weather"`
+	Mood      string    `json:"mood"`
+	Date      string    `json:"date"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DiaryRevision is a saved version of a diary entry
+type DiaryRevision struct {
+	ID        int       `json:"id"`
+	DiaryID   int       `json:"diary_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Weather   string    `json:"weather"`
+	Mood      string    `json:"mood"`
+	Date      time.Time `json:"date"`
+	Encrypted bool      `json:"encrypted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DiffLine is one line of a line-based diff; Kind is "same", "add" or "del"
+type DiffLine struct {
+	Kind string
+	Text string
+}
+
+// HighlightSegment is a piece of text in a search result; Match marks the
+// parts that matched the query
+type HighlightSegment struct {
+	Text  string
+	Match bool
+}
+
+// DiarySearchResult is a diary entry found by full-text search
+type DiarySearchResult struct {
+	Diary   Diary
+	Title   []HighlightSegment
+	Snippet []HighlightSegment
+}